@@ -1,18 +1,28 @@
 document.addEventListener('DOMContentLoaded', () => {
     initBarChart();
     initDropdown();
+    initLiveVisitors();
 });
 
 function initBarChart() {
     const tooltip = document.querySelector('.tooltip');
     const tooltipLabel = document.querySelector('.tooltip > .label');
     const tooltipValue = document.querySelector('.tooltip > .value');
+    const tooltipSecondaryValue = document.querySelector('.tooltip > .secondary-value');
+    const tooltipComparisonValue = document.querySelector('.tooltip > .comparison-value');
     const bars = document.querySelectorAll('.bar');
 
     bars.forEach(bar => {
         bar.addEventListener('mousemove', (e) => {
             tooltipLabel.textContent = bar.getAttribute('data-label');
             tooltipValue.textContent = `${bar.getAttribute('data-value')} views`;
+            tooltipSecondaryValue.textContent = `${bar.getAttribute('data-secondary-value')} visitors`;
+            if (bar.hasAttribute('data-comparison-value')) {
+                tooltipComparisonValue.textContent = `${bar.getAttribute('data-comparison-value')} views in previous period`;
+                tooltipComparisonValue.style.display = 'block';
+            } else {
+                tooltipComparisonValue.style.display = 'none';
+            }
             tooltip.style.display = 'flex';
 
             const barRect = bar.getBoundingClientRect();
@@ -38,6 +48,45 @@ function initBarChart() {
     });
 }
 
+// Counts and paths are replaced with each Server-Sent Event, EventSource reconnects on its own if the stream drops
+function initLiveVisitors() {
+    const containers = document.querySelectorAll('[data-live-events]');
+
+    containers.forEach(container => {
+        const source = new EventSource(container.getAttribute('data-live-events'));
+
+        source.addEventListener('message', (e) => {
+            const liveVisitors = JSON.parse(e.data);
+
+            container.querySelector('.live-visitors').textContent = liveVisitors.visitors;
+
+            const table = container.querySelector('.live-paths');
+            if (!table) {
+                return;
+            }
+
+            const rows = liveVisitors.paths.map(livePath => {
+                const row = document.createElement('tr');
+                const path = document.createElement('td');
+                const metrics = document.createElement('td');
+                const value = document.createElement('div');
+
+                path.className = 'text';
+                path.textContent = livePath.path;
+                metrics.className = 'metrics';
+                value.className = 'value';
+                value.title = 'Visitors';
+                value.textContent = livePath.visitors;
+
+                metrics.appendChild(value);
+                row.append(path, metrics);
+                return row;
+            });
+            table.replaceChildren(...rows);
+        });
+    });
+}
+
 function initDropdown() {
     const dropdowns = document.querySelectorAll('.dropdown-container');
     dropdowns.forEach(el => {
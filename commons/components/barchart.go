@@ -1,29 +1,37 @@
 package components
 
 type BarChartInputDataPoint struct {
-	Label string
-	Data  int
+	Label          string
+	Data           int
+	SecondaryData  int // Drawn over the primary bar, should not exceed Data
+	ComparisonData int // Marked over the primary bar when the chart is comparing against another period
 }
 
 type BarChart struct {
-	Height float64
-	Width  float64
-	Data   []BarChartDataPoint
+	Height      float64
+	Width       float64
+	IsComparing bool
+	Data        []BarChartDataPoint
 }
 
 type BarChartDataPoint struct {
-	X         float64
-	Y         float64
-	Width     float64
-	Height    float64
-	MaxHeight float64
-	TopOffset float64
-	Value     int
-	Label     string
+	X               float64
+	Y               float64
+	Width           float64
+	Height          float64
+	MaxHeight       float64
+	TopOffset       float64
+	Value           int
+	Label           string
+	SecondaryY      float64
+	SecondaryHeight float64
+	SecondaryValue  int
+	ComparisonY     float64
+	ComparisonValue int
 }
 
 // SVG Coordinate System: https://developer.mozilla.org/en-US/docs/Web/SVG/Tutorial/Positions#the_grid
-func NewBarChart(input []BarChartInputDataPoint) BarChart {
+func NewBarChart(input []BarChartInputDataPoint, isComparing bool) BarChart {
 	chartWidth := 900.0
 	chartHeight := 200.0
 	chartTopOffset := 20.0
@@ -39,9 +47,16 @@ func NewBarChart(input []BarChartInputDataPoint) BarChart {
 		if dataPoint.Data > maxValue {
 			maxValue = dataPoint.Data
 		}
+		if dataPoint.ComparisonData > maxValue {
+			maxValue = dataPoint.ComparisonData
+		}
 	}
 
-	barHeightScaleFactor := float64(availableBarHeight) / float64(maxValue)
+	// A series of zeros is drawn as empty bars
+	barHeightScaleFactor := 0.0
+	if maxValue > 0 {
+		barHeightScaleFactor = float64(availableBarHeight) / float64(maxValue)
+	}
 
 	bars := []BarChartDataPoint{}
 	for i, dataPoint := range input {
@@ -54,13 +69,21 @@ func NewBarChart(input []BarChartInputDataPoint) BarChart {
 			TopOffset: chartTopOffset,
 			Value:     dataPoint.Data,
 			Label:     dataPoint.Label,
+
+			SecondaryY:      chartTopOffset + availableBarHeight - (float64(dataPoint.SecondaryData) * barHeightScaleFactor),
+			SecondaryHeight: chartTopOffset + float64(dataPoint.SecondaryData)*barHeightScaleFactor,
+			SecondaryValue:  dataPoint.SecondaryData,
+
+			ComparisonY:     chartTopOffset + availableBarHeight - (float64(dataPoint.ComparisonData) * barHeightScaleFactor),
+			ComparisonValue: dataPoint.ComparisonData,
 		}
 		bars = append(bars, bar)
 	}
 
 	return BarChart{
-		Height: chartHeight,
-		Width:  chartWidth,
-		Data:   bars,
+		Height:      chartHeight,
+		Width:       chartWidth,
+		IsComparing: isComparing,
+		Data:        bars,
 	}
 }
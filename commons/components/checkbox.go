@@ -0,0 +1,8 @@
+package components
+
+type Checkbox struct {
+	ID        string
+	Label     string
+	Hint      string
+	IsChecked bool
+}
@@ -13,3 +13,6 @@ type DateRangeOption struct {
 }
 
 var DateRangeValues = []DataRangeType{"24h", "1w", "1m", "3m", "1y"}
+
+// Absolute range picked by the user, the dates are carried in the URL as from and to
+var CustomDateRange DataRangeType = "custom"
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Token bucket limiter, each key gets a bucket that holds up to a minute's worth of requests
+// and refills continuously, so short bursts are allowed while the average rate is capped
+// https://en.wikipedia.org/wiki/Token_bucket
+type Limiter struct {
+	mutex          sync.Mutex
+	ratePerMinute  int
+	buckets        map[string]*bucket
+	lastPrunedAt   time.Time
+	pruneAfterIdle time.Duration
+}
+
+type bucket struct {
+	tokens     float64
+	lastFillAt time.Time
+}
+
+func NewLimiter(ratePerMinute int) *Limiter {
+	return &Limiter{
+		ratePerMinute:  ratePerMinute,
+		buckets:        make(map[string]*bucket),
+		lastPrunedAt:   time.Now(),
+		pruneAfterIdle: 10 * time.Minute,
+	}
+}
+
+func (l *Limiter) SetRate(ratePerMinute int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.ratePerMinute = ratePerMinute
+}
+
+func (l *Limiter) Allow(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	capacity := float64(l.ratePerMinute)
+
+	l.prune(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: capacity, lastFillAt: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.lastFillAt).Minutes()
+	b.tokens = min(capacity, b.tokens+elapsed*capacity)
+	b.lastFillAt = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// Buckets idle for long enough are full again, so dropping them doesn't change behaviour
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrunedAt) < time.Minute {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastFillAt) > l.pruneAfterIdle {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastPrunedAt = now
+}
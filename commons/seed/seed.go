@@ -8,6 +8,7 @@ import (
 	"mouji/features/pageviews"
 	"mouji/features/projects"
 	"mouji/features/users"
+	"time"
 )
 
 func SeedUsers(resources embed.FS) {
@@ -47,6 +48,9 @@ func SeedPageViews(resources embed.FS) {
 		projectNameToIDMap[project.Name] = project.ProjectID
 	}
 
+	var records []pageviews.PageViewRecord
+	receivedAt := time.Now().UTC().Format(time.DateTime)
+
 	rows := readCSV(resources, "commons/seed/pageviews.csv")
 	for i, row := range rows {
 		if i == 0 {
@@ -55,14 +59,17 @@ func SeedPageViews(resources embed.FS) {
 
 		randomViewCount := rand.Intn(50)
 		for i := 0; i <= randomViewCount; i++ {
-			pageviews.InsertPageView(pageviews.PageViewRecord{
-				ProjectID: projectNameToIDMap[row[0]],
-				Path:      row[1],
-				Title:     row[2],
-				Referrer:  row[3],
+			records = append(records, pageviews.PageViewRecord{
+				ProjectID:  projectNameToIDMap[row[0]],
+				Path:       row[1],
+				Title:      row[2],
+				Referrer:   row[3],
+				ReceivedAt: receivedAt,
 			})
 		}
 	}
+
+	pageviews.InsertPageViews(records)
 }
 
 func readCSV(resources embed.FS, path string) [][]string {
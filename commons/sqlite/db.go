@@ -33,6 +33,19 @@ func NewDB() error {
 	return nil
 }
 
+// Checkpoints the WAL into the database file before closing, so that the file is complete on its own after shutdown
+func Close() {
+	_, err := DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	if err != nil {
+		slog.Error("error checkpointing WAL", "error", err)
+	}
+
+	err = DB.Close()
+	if err != nil {
+		slog.Error("error closing sqlite", "error", err)
+	}
+}
+
 func getDataFolderPath() string {
 	path := os.Getenv("DATA_FOLDER")
 
@@ -1,7 +1,6 @@
 package sqlite
 
 import (
-	"embed"
 	"fmt"
 	"io/fs"
 	"log/slog"
@@ -17,7 +16,7 @@ type migration struct {
 	isApplied bool
 }
 
-func Migrate(resources embed.FS) {
+func Migrate(resources fs.FS) {
 	createMigrationsTable()
 
 	migrations := getAllMigrations(resources)
@@ -46,7 +45,7 @@ func createMigrationsTable() {
 	}
 }
 
-func getAllMigrations(resources embed.FS) []migration {
+func getAllMigrations(resources fs.FS) []migration {
 	var migrations []migration
 
 	fs.WalkDir(resources, ".", func(path string, d fs.DirEntry, err error) error {
@@ -59,7 +58,7 @@ func getAllMigrations(resources embed.FS) []migration {
 	return migrations
 }
 
-func getMigration(resources embed.FS, path string, name string) migration {
+func getMigration(resources fs.FS, path string, name string) migration {
 	content, err := fs.ReadFile(resources, path)
 
 	if err != nil {
@@ -0,0 +1,16 @@
+package timezones
+
+import (
+	"time"
+)
+
+// Accepts names from the IANA time zone database like Europe/Berlin, but not offsets like +01:00.
+// "Local" depends on the server's timezone and "" means UTC to time.LoadLocation, so callers that allow an empty value check for it first
+func IsValid(timezone string) bool {
+	if timezone == "" || timezone == "Local" {
+		return false
+	}
+
+	_, err := time.LoadLocation(timezone)
+	return err == nil
+}
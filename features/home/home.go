@@ -2,6 +2,7 @@ package home
 
 import (
 	"fmt"
+	"log/slog"
 	"mouji/commons/components"
 	"mouji/commons/config"
 	"mouji/commons/templates"
@@ -9,24 +10,144 @@ import (
 	"mouji/features/projects"
 	"mouji/features/users"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type urlState struct {
 	selectedProjectID          string
 	selectedDateRange          components.DataRangeType
+	selectedFrom               string // YYYY-MM-DD, only for custom date ranges
+	selectedTo                 string // YYYY-MM-DD and inclusive, only for custom date ranges
 	currentPageViewTableOffset string
+	currentSourceTableOffset   string
+	currentEventTableOffset    string
+	isComparing                bool // Compare against the previous period of the same length
+	filters                    pageviews.Filters
+}
+
+// Custom date ranges are bounded so that a single URL can't make the chart render thousands of monthly bars
+var earliestCustomDate = "2000-01-01"
+var maxCustomDateRangeYears = 10
+
+// Filters in the order they're shown, Key is the query parameter and the dimension of the breakdown tables
+var filterNames = []struct {
+	Key  string
+	Name string
+}{
+	{"path", "Page"},
+	{"source", "Source"},
+	{"browser", "Browser"},
+	{"os", "Operating System"},
+	{"device_type", "Device"},
+	{"event", "Event"},
+}
+
+type activeFilter struct {
+	Key        string
+	Name       string
+	Value      string
+	RemoveLink string
 }
 
 type pageViewsTable struct {
-	Records              []pageviews.PaginatedPageViewRecord
+	Records              []pageViewsTableRecord
+	IsComparing          bool
+	ShouldShowPagination bool
+	Pagination           components.Pagination
+}
+
+type pageViewsTableRecord struct {
+	Title       string
+	Path        string
+	Views       int
+	Visitors    int
+	ViewsChange change
+	FilterLink  string
+}
+
+type sourcesTable struct {
+	Records              []sourcesTableRecord
+	ShouldShowPagination bool
+	Pagination           components.Pagination
+}
+
+type sourcesTableRecord struct {
+	Source     string
+	Views      int
+	FilterLink string
+}
+
+type eventsTable struct {
+	Records              []eventsTableRecord
 	ShouldShowPagination bool
 	Pagination           components.Pagination
 }
 
+type eventsTableRecord struct {
+	Name       string
+	Count      int
+	Visitors   int
+	FilterLink string
+}
+
+type goalsTable struct {
+	Records []goalsTableRecord
+}
+
+type goalsTableRecord struct {
+	Name           string
+	Completions    int
+	Visitors       int
+	ConversionRate string
+	FilterLink     string
+}
+
+type breakdownTable struct {
+	Title   string
+	Records []breakdownTableRecord
+}
+
+type breakdownTableRecord struct {
+	Name       string
+	Views      int
+	Visitors   int
+	FilterLink string
+}
+
+type customDateRangeForm struct {
+	IsVisible   bool
+	IsComparing bool
+	Filters     []activeFilter // Kept as hidden inputs
+	ProjectID   string
+	From        string
+	To          string
+	MinDate     string // Bounds of the date pickers, see isValidDateRange
+	MaxDate     string
+	ApplyButton components.Button
+}
+
 type pageViewsChart struct {
-	TotalCount int
-	BarChart   components.BarChart
+	TotalCount          int
+	TotalVisitors       int
+	BotCount            int
+	LiveVisitors        int
+	IsComparing         bool
+	TotalCountChange    change
+	TotalVisitorsChange change
+	CompareButton       components.Button
+	BarChart            components.BarChart
+}
+
+// Difference from the previous period, Direction is "up", "down" or empty when unchanged
+type change struct {
+	Previous   int
+	Delta      string
+	Percentage string
+	Direction  string
 }
 
 func HandleHomePage(w http.ResponseWriter, r *http.Request) {
@@ -55,71 +176,204 @@ func HandleHomePage(w http.ResponseWriter, r *http.Request) {
 	var state urlState
 	state.selectedProjectID = r.URL.Query().Get("project_id")
 	state.selectedDateRange = components.DataRangeType(r.URL.Query().Get("daterange"))
+	state.selectedFrom = r.URL.Query().Get("from")
+	state.selectedTo = r.URL.Query().Get("to")
 	state.currentPageViewTableOffset = r.URL.Query().Get("current_pageview_table_offset")
+	state.currentSourceTableOffset = r.URL.Query().Get("current_source_table_offset")
+	state.currentEventTableOffset = r.URL.Query().Get("current_event_table_offset")
+	state.isComparing = r.URL.Query().Get("compare") == "true"
+	for _, filter := range filterNames {
+		setFilter(&state.filters, filter.Key, r.URL.Query().Get(filter.Key))
+	}
 
 	if state.selectedProjectID == "" {
-		newURL := fmt.Sprintf("/?project_id=%s&daterange=%s&current_pageview_table_offset=%d", projects[0].ProjectID, components.DateRangeValues[0], 0)
-		http.Redirect(w, r, newURL, http.StatusSeeOther)
+		state.selectedProjectID = projects[0].ProjectID
+		state.selectedDateRange = components.DateRangeValues[0]
+		state.currentPageViewTableOffset = "0"
+		state.currentSourceTableOffset = "0"
+		state.currentEventTableOffset = "0"
+		http.Redirect(w, r, getHomePageURL(state), http.StatusSeeOther)
 		return
 	}
 
-	renderHomePage(w, state, projects)
+	location := getLocation(r, projects, state.selectedProjectID)
+
+	if !isValidDateRange(state, location) {
+		state.selectedDateRange = components.DateRangeValues[0]
+		state.selectedFrom = ""
+		state.selectedTo = ""
+	}
+
+	renderHomePage(w, state, projects, location)
 }
 
-func renderHomePage(w http.ResponseWriter, state urlState, projects []projects.ProjectRecord) {
+func renderHomePage(w http.ResponseWriter, state urlState, projects []projects.ProjectRecord, location *time.Location) {
 	type templateData struct {
-		Navbar         components.Navbar
-		PageViewsChart pageViewsChart
-		PageViewsTable pageViewsTable
+		Navbar          components.Navbar
+		ProjectID       string
+		CustomDateRange customDateRangeForm
+		Filters         []activeFilter
+		PageViewsChart  pageViewsChart
+		PageViewsTable  pageViewsTable
+		SourcesTable    sourcesTable
+		BrowsersTable   breakdownTable
+		OSTable         breakdownTable
+		DevicesTable    breakdownTable
+		EventsTable     eventsTable
+		GoalsTable      goalsTable
 	}
 
-	navbar := getNavbar(state, projects)
+	navbar := getNavbar(state, projects, location)
+	timeRange := getTimeRange(state, location)
+	previousTimeRange := getPreviousTimeRange(state, timeRange)
 
-	pageViewsCount, err := pageviews.GetPageViewCountsByInterval(state.selectedProjectID, state.selectedDateRange)
+	pageViewsCount, err := pageviews.GetPageViewCountsByInterval(state.selectedProjectID, timeRange, state.filters)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Intervals of both periods line up by their position, the nth day of this week against the nth day of last week
+	previousCounts := make(map[int]int)
+	previousTotalCount := 0
+	if state.isComparing {
+		previousPageViewsCount, err := pageviews.GetPageViewCountsByInterval(state.selectedProjectID, previousTimeRange, state.filters)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, record := range previousPageViewsCount {
+			previousCounts[record.Position] = record.Count
+			previousTotalCount = record.TotalCount
+		}
+	}
+
 	totalCount := 0
 	barChartInputDataPoints := []components.BarChartInputDataPoint{}
 	for _, record := range pageViewsCount {
 		barChartInputDataPoint := components.BarChartInputDataPoint{
-			Label: record.Interval,
-			Data:  record.Count,
+			Label:          record.Interval,
+			Data:           record.Count,
+			SecondaryData:  record.Visitors,
+			ComparisonData: previousCounts[record.Position],
 		}
 		barChartInputDataPoints = append(barChartInputDataPoints, barChartInputDataPoint)
 		totalCount = record.TotalCount
 	}
-	barChart := components.NewBarChart(barChartInputDataPoints)
+	barChart := components.NewBarChart(barChartInputDataPoints, state.isComparing)
+
+	totalVisitors, err := pageviews.GetVisitorCount(state.selectedProjectID, timeRange, state.filters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	previousTotalVisitors := 0
+	if state.isComparing {
+		previousTotalVisitors, err = pageviews.GetVisitorCount(state.selectedProjectID, previousTimeRange, state.filters)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	botCount, err := pageviews.GetBotCount(state.selectedProjectID, timeRange, state.filters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	compareState := getFirstPageState(state)
+	compareState.isComparing = !state.isComparing
+
 	chart := pageViewsChart{
-		TotalCount: totalCount,
-		BarChart:   barChart,
+		TotalCount:          totalCount,
+		TotalVisitors:       totalVisitors,
+		BotCount:            botCount,
+		LiveVisitors:        pageviews.GetLiveVisitors(state.selectedProjectID).Visitors,
+		IsComparing:         state.isComparing,
+		TotalCountChange:    getChange(totalCount, previousTotalCount),
+		TotalVisitorsChange: getChange(totalVisitors, previousTotalVisitors),
+		CompareButton: components.Button{
+			Text:      "Compare",
+			Link:      getHomePageURL(compareState),
+			IsPrimary: state.isComparing,
+		},
+		BarChart: barChart,
+	}
+
+	table, err := getPageViewsTable(state, timeRange, previousTimeRange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sources, err := getSourcesTable(state, timeRange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	table, err := getPageViewsTable(state)
+	browsers, err := getBreakdownTable(state, timeRange, "Browsers", pageviews.BrowserDimension)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	operatingSystems, err := getBreakdownTable(state, timeRange, "Operating Systems", pageviews.OSDimension)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	devices, err := getBreakdownTable(state, timeRange, "Devices", pageviews.DeviceTypeDimension)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events, err := getEventsTable(state, timeRange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	goals, err := getGoalsTable(state, timeRange, totalVisitors)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	tmplData := templateData{
-		Navbar:         navbar,
-		PageViewsChart: chart,
-		PageViewsTable: table,
+		Navbar:          navbar,
+		ProjectID:       state.selectedProjectID,
+		CustomDateRange: getCustomDateRangeForm(state, location),
+		Filters:         getActiveFilters(state),
+		PageViewsChart:  chart,
+		PageViewsTable:  table,
+		SourcesTable:    sources,
+		BrowsersTable:   browsers,
+		OSTable:         operatingSystems,
+		DevicesTable:    devices,
+		EventsTable:     events,
+		GoalsTable:      goals,
 	}
 
 	templates.Render(w, "home.html", tmplData)
 }
 
-func getNavbar(state urlState, projects []projects.ProjectRecord) components.Navbar {
+func getNavbar(state urlState, projects []projects.ProjectRecord, location *time.Location) components.Navbar {
 	navbar := components.NewNavbar(true)
 	var allOptions []components.DropdownOption
 	var selectedOption components.DropdownOption
 	for _, project := range projects {
 		var option components.DropdownOption
 		option.Name = project.Name
-		option.Link = fmt.Sprintf("/?project_id=%s&daterange=%s", project.ProjectID, state.selectedDateRange)
+		projectState := getFirstPageState(state)
+		projectState.selectedProjectID = project.ProjectID
+		projectState.filters = pageviews.Filters{} // Paths and events of one project don't mean much in another
+		option.Link = getHomePageURL(projectState)
 		option.Value = ""
 		allOptions = append(allOptions, option)
 		if project.ProjectID == state.selectedProjectID {
@@ -133,29 +387,183 @@ func getNavbar(state urlState, projects []projects.ProjectRecord) components.Nav
 	navbar.ProjectsDropdown.AllOptions = allOptions
 	navbar.ProjectsDropdown.InputName = ""
 
-	navbar.DateRange = getDateRange(state)
+	navbar.DateRange = getDateRange(state, location)
 
 	return navbar
 }
 
-func getDateRange(state urlState) components.DateRange {
+func getDateRange(state urlState, location *time.Location) components.DateRange {
 	var daterange components.DateRange
 
 	for _, value := range components.DateRangeValues {
+		optionState := getFirstPageState(state)
+		optionState.selectedDateRange = value
+		optionState.selectedFrom = ""
+		optionState.selectedTo = ""
+
 		var option components.DateRangeOption
 		option.Name = value
-		option.Link = fmt.Sprintf("/?project_id=%s&daterange=%s", state.selectedProjectID, value)
+		option.Link = getHomePageURL(optionState)
 		if value == state.selectedDateRange {
 			option.IsSelected = true
 		}
 		daterange.Options = append(daterange.Options, option)
 	}
 
+	// Custom starts off with the dates of the selected range so that it can be tweaked from there
+	customState := getFirstPageState(state)
+	if state.selectedDateRange != components.CustomDateRange {
+		timeRange := getTimeRange(state, location)
+		customState.selectedDateRange = components.CustomDateRange
+		customState.selectedFrom = timeRange.From.In(location).Format(time.DateOnly)
+		customState.selectedTo = timeRange.To.Add(-time.Second).In(location).Format(time.DateOnly)
+	}
+
+	daterange.Options = append(daterange.Options, components.DateRangeOption{
+		Name:       components.CustomDateRange,
+		Link:       getHomePageURL(customState),
+		IsSelected: state.selectedDateRange == components.CustomDateRange,
+	})
+
 	return daterange
 }
 
-func getPageViewsTable(state urlState) (pageViewsTable, error) {
-	var records []pageviews.PaginatedPageViewRecord
+func getCustomDateRangeForm(state urlState, location *time.Location) customDateRangeForm {
+	return customDateRangeForm{
+		IsVisible:   state.selectedDateRange == components.CustomDateRange,
+		IsComparing: state.isComparing,
+		Filters:     getActiveFilters(state),
+		ProjectID:   state.selectedProjectID,
+		From:        state.selectedFrom,
+		To:          state.selectedTo,
+		MinDate:     earliestCustomDate,
+		MaxDate:     time.Now().In(location).Format(time.DateOnly),
+		ApplyButton: components.Button{
+			Text:     "Apply",
+			IsSubmit: true,
+		},
+	}
+}
+
+// Presets end now and start at the beginning of the hour or day, custom ranges cover whole days.
+// Days start at midnight in the given location, AddDate keeps them there across DST transitions
+func getTimeRange(state urlState, location *time.Location) pageviews.TimeRange {
+	now := time.Now().In(location)
+	startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+	switch state.selectedDateRange {
+	case components.CustomDateRange:
+		from, _ := time.ParseInLocation(time.DateOnly, state.selectedFrom, location)
+		to, _ := time.ParseInLocation(time.DateOnly, state.selectedTo, location)
+		return pageviews.TimeRange{From: from, To: to.AddDate(0, 0, 1), Location: location}
+	case "1w":
+		return pageviews.TimeRange{From: startOfToday.AddDate(0, 0, -6), To: now, Location: location}
+	case "1m":
+		return pageviews.TimeRange{From: startOfToday.AddDate(0, -1, 0), To: now, Location: location}
+	case "3m":
+		return pageviews.TimeRange{From: startOfToday.AddDate(0, -3, 0), To: now, Location: location}
+	case "1y":
+		return pageviews.TimeRange{From: startOfToday.AddDate(-1, 0, 0), To: now, Location: location}
+	}
+
+	return pageviews.TimeRange{From: now.Add(-24 * time.Hour).Truncate(time.Hour), To: now, Location: location}
+}
+
+// The same time range a period earlier, last week for "1w" and the same number of days before a custom range
+func getPreviousTimeRange(state urlState, timeRange pageviews.TimeRange) pageviews.TimeRange {
+	shift := func(t time.Time) time.Time { return t.Add(-24 * time.Hour) }
+
+	switch state.selectedDateRange {
+	case components.CustomDateRange:
+		from, _ := time.Parse(time.DateOnly, state.selectedFrom)
+		to, _ := time.Parse(time.DateOnly, state.selectedTo)
+		days := int(to.Sub(from).Hours()/24) + 1
+		shift = func(t time.Time) time.Time { return t.AddDate(0, 0, -days) }
+	case "1w":
+		shift = func(t time.Time) time.Time { return t.AddDate(0, 0, -7) }
+	case "1m":
+		shift = func(t time.Time) time.Time { return t.AddDate(0, -1, 0) }
+	case "3m":
+		shift = func(t time.Time) time.Time { return t.AddDate(0, -3, 0) }
+	case "1y":
+		shift = func(t time.Time) time.Time { return t.AddDate(-1, 0, 0) }
+	}
+
+	return pageviews.TimeRange{From: shift(timeRange.From), To: shift(timeRange.To), Location: timeRange.Location}
+}
+
+// Percentage is "new" when there was nothing in the previous period to compare against
+func getChange(current int, previous int) change {
+	delta := current - previous
+
+	result := change{
+		Previous:   previous,
+		Delta:      fmt.Sprintf("%+d", delta),
+		Percentage: "new",
+	}
+
+	if previous > 0 {
+		result.Percentage = fmt.Sprintf("%+.0f%%", float64(delta)/float64(previous)*100)
+	} else if current == 0 {
+		result.Percentage = "0%"
+	}
+
+	if delta > 0 {
+		result.Direction = "up"
+	} else if delta < 0 {
+		result.Direction = "down"
+	}
+
+	return result
+}
+
+// The user's timezone overrides the project's, timezones that fail to load fall back to UTC
+func getLocation(r *http.Request, projects []projects.ProjectRecord, projectID string) *time.Location {
+	timezone := ""
+	for _, project := range projects {
+		if project.ProjectID == projectID {
+			timezone = project.Timezone
+		}
+	}
+
+	user, err := users.GetSessionUser(r)
+	if err == nil && user.Timezone != "" {
+		timezone = user.Timezone
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		slog.Error("error loading timezone", "timezone", timezone, "error", err)
+		return time.UTC
+	}
+
+	return location
+}
+
+// Custom ranges can't start before earliestCustomDate, end after today or span more than maxCustomDateRangeYears
+func isValidDateRange(state urlState, location *time.Location) bool {
+	if state.selectedDateRange != components.CustomDateRange {
+		return slices.Contains(components.DateRangeValues, state.selectedDateRange)
+	}
+
+	from, err := time.Parse(time.DateOnly, state.selectedFrom)
+	if err != nil {
+		return false
+	}
+
+	to, err := time.Parse(time.DateOnly, state.selectedTo)
+	if err != nil {
+		return false
+	}
+
+	earliest, _ := time.Parse(time.DateOnly, earliestCustomDate)
+	today, _ := time.Parse(time.DateOnly, time.Now().In(location).Format(time.DateOnly))
+
+	return !to.Before(from) && !from.Before(earliest) && !to.After(today) && to.Before(from.AddDate(maxCustomDateRangeYears, 0, 0))
+}
+
+func getPageViewsTable(state urlState, timeRange pageviews.TimeRange, previousTimeRange pageviews.TimeRange) (pageViewsTable, error) {
+	var records []pageViewsTableRecord
 	limit := 10
 
 	pageViewTableOffset, err := strconv.Atoi(state.currentPageViewTableOffset)
@@ -165,6 +573,7 @@ func getPageViewsTable(state urlState) (pageViewsTable, error) {
 
 	table := pageViewsTable{
 		Records:              records,
+		IsComparing:          state.isComparing,
 		ShouldShowPagination: false,
 		Pagination: components.Pagination{
 			PageStartRecord: pageViewTableOffset + 1,
@@ -175,26 +584,332 @@ func getPageViewsTable(state urlState) (pageViewsTable, error) {
 		},
 	}
 
-	records, err = pageviews.GetPaginatedPageViews(state.selectedProjectID, state.selectedDateRange, limit, pageViewTableOffset)
+	pageViews, err := pageviews.GetPaginatedPageViews(state.selectedProjectID, timeRange, state.filters, limit, pageViewTableOffset)
 	if err != nil {
 		return table, err
 	}
 
+	// Only the paths on this page are looked up in the previous period
+	previousViews := make(map[string]int)
+	if state.isComparing && len(pageViews) > 0 {
+		var paths []string
+		for _, pageView := range pageViews {
+			paths = append(paths, pageView.Path)
+		}
+
+		previousViews, err = pageviews.GetPageViewsByPath(state.selectedProjectID, previousTimeRange, state.filters, paths)
+		if err != nil {
+			return table, err
+		}
+	}
+
+	for _, pageView := range pageViews {
+		record := pageViewsTableRecord{
+			Title:       pageView.Title,
+			Path:        pageView.Path,
+			Views:       pageView.Views,
+			Visitors:    pageView.Visitors,
+			ViewsChange: getChange(pageView.Views, previousViews[pageView.Path]),
+			FilterLink:  getFilterLink(state, "path", pageView.Path),
+		}
+		records = append(records, record)
+	}
+
 	if len(records) > 0 {
 		table.Records = records
-		table.Pagination.TotalRecords = records[0].TotalRecords
+		table.Pagination.TotalRecords = pageViews[0].TotalRecords
 		table.Pagination.PageStartRecord = pageViewTableOffset + 1
 		table.Pagination.PageEndRecord = pageViewTableOffset + len(records)
-		table.ShouldShowPagination = records[0].TotalRecords > limit
+		table.ShouldShowPagination = pageViews[0].TotalRecords > limit
 	}
 
 	if table.ShouldShowPagination && pageViewTableOffset != 0 {
-		table.Pagination.PrevLink = fmt.Sprintf("/?project_id=%s&daterange=%s&current_pageview_table_offset=%d", state.selectedProjectID, state.selectedDateRange, pageViewTableOffset-limit)
+		prevState := state
+		prevState.currentPageViewTableOffset = strconv.Itoa(pageViewTableOffset - limit)
+		table.Pagination.PrevLink = getHomePageURL(prevState)
 	}
 
 	if table.ShouldShowPagination && pageViewTableOffset+limit < table.Pagination.TotalRecords {
-		table.Pagination.NextLink = fmt.Sprintf("/?project_id=%s&daterange=%s&current_pageview_table_offset=%d", state.selectedProjectID, state.selectedDateRange, pageViewTableOffset+limit)
+		nextState := state
+		nextState.currentPageViewTableOffset = strconv.Itoa(pageViewTableOffset + limit)
+		table.Pagination.NextLink = getHomePageURL(nextState)
+	}
+
+	return table, nil
+}
+
+func getSourcesTable(state urlState, timeRange pageviews.TimeRange) (sourcesTable, error) {
+	var records []sourcesTableRecord
+	limit := 10
+
+	sourceTableOffset, err := strconv.Atoi(state.currentSourceTableOffset)
+	if err != nil {
+		sourceTableOffset = 0
+	}
+
+	table := sourcesTable{
+		Records:              records,
+		ShouldShowPagination: false,
+		Pagination: components.Pagination{
+			PageStartRecord: sourceTableOffset + 1,
+			PageEndRecord:   0,
+			TotalRecords:    0,
+			PrevLink:        "",
+			NextLink:        "",
+		},
+	}
+
+	sources, err := pageviews.GetPaginatedSources(state.selectedProjectID, timeRange, state.filters, limit, sourceTableOffset)
+	if err != nil {
+		return table, err
+	}
+
+	for _, source := range sources {
+		record := sourcesTableRecord{
+			Source:     source.Source,
+			Views:      source.Views,
+			FilterLink: getFilterLink(state, "source", source.Source),
+		}
+		records = append(records, record)
+	}
+
+	if len(records) > 0 {
+		table.Records = records
+		table.Pagination.TotalRecords = sources[0].TotalRecords
+		table.Pagination.PageStartRecord = sourceTableOffset + 1
+		table.Pagination.PageEndRecord = sourceTableOffset + len(records)
+		table.ShouldShowPagination = sources[0].TotalRecords > limit
+	}
+
+	if table.ShouldShowPagination && sourceTableOffset != 0 {
+		prevState := state
+		prevState.currentSourceTableOffset = strconv.Itoa(sourceTableOffset - limit)
+		table.Pagination.PrevLink = getHomePageURL(prevState)
+	}
+
+	if table.ShouldShowPagination && sourceTableOffset+limit < table.Pagination.TotalRecords {
+		nextState := state
+		nextState.currentSourceTableOffset = strconv.Itoa(sourceTableOffset + limit)
+		table.Pagination.NextLink = getHomePageURL(nextState)
+	}
+
+	return table, nil
+}
+
+func getEventsTable(state urlState, timeRange pageviews.TimeRange) (eventsTable, error) {
+	var records []eventsTableRecord
+	limit := 10
+
+	eventTableOffset, err := strconv.Atoi(state.currentEventTableOffset)
+	if err != nil {
+		eventTableOffset = 0
+	}
+
+	table := eventsTable{
+		Records:              records,
+		ShouldShowPagination: false,
+		Pagination: components.Pagination{
+			PageStartRecord: eventTableOffset + 1,
+			PageEndRecord:   0,
+			TotalRecords:    0,
+			PrevLink:        "",
+			NextLink:        "",
+		},
+	}
+
+	events, err := pageviews.GetPaginatedEvents(state.selectedProjectID, timeRange, state.filters, limit, eventTableOffset)
+	if err != nil {
+		return table, err
+	}
+
+	for _, event := range events {
+		record := eventsTableRecord{
+			Name:       event.Name,
+			Count:      event.Count,
+			Visitors:   event.Visitors,
+			FilterLink: getFilterLink(state, "event", event.Name),
+		}
+		records = append(records, record)
+	}
+
+	if len(records) > 0 {
+		table.Records = records
+		table.Pagination.TotalRecords = events[0].TotalRecords
+		table.Pagination.PageStartRecord = eventTableOffset + 1
+		table.Pagination.PageEndRecord = eventTableOffset + len(records)
+		table.ShouldShowPagination = events[0].TotalRecords > limit
+	}
+
+	if table.ShouldShowPagination && eventTableOffset != 0 {
+		prevState := state
+		prevState.currentEventTableOffset = strconv.Itoa(eventTableOffset - limit)
+		table.Pagination.PrevLink = getHomePageURL(prevState)
+	}
+
+	if table.ShouldShowPagination && eventTableOffset+limit < table.Pagination.TotalRecords {
+		nextState := state
+		nextState.currentEventTableOffset = strconv.Itoa(eventTableOffset + limit)
+		table.Pagination.NextLink = getHomePageURL(nextState)
+	}
+
+	return table, nil
+}
+
+// Conversion rate is the share of all visitors in the time range who completed the goal, or of the filtered visitors when filtering
+func getGoalsTable(state urlState, timeRange pageviews.TimeRange, totalVisitors int) (goalsTable, error) {
+	var table goalsTable
+
+	goals, err := projects.GetGoalsByProjectID(state.selectedProjectID)
+	if err != nil {
+		return table, err
+	}
+
+	for _, goal := range goals {
+		conversion, err := pageviews.GetGoalConversion(goal, timeRange, state.filters)
+		if err != nil {
+			return table, err
+		}
+
+		conversionRate := 0.0
+		if totalVisitors > 0 {
+			conversionRate = float64(conversion.Visitors) / float64(totalVisitors) * 100
+		}
+
+		record := goalsTableRecord{
+			Name:           conversion.Name,
+			Completions:    conversion.Completions,
+			Visitors:       conversion.Visitors,
+			ConversionRate: fmt.Sprintf("%.1f%%", conversionRate),
+		}
+
+		// The path filter matches a single path, so path goals with a pattern like "/docs/*" aren't linked
+		if goal.Type == projects.EventGoalType {
+			record.FilterLink = getFilterLink(state, "event", goal.Target)
+		} else if !strings.ContainsAny(goal.Target, "*?[") {
+			record.FilterLink = getFilterLink(state, "path", goal.Target)
+		}
+		table.Records = append(table.Records, record)
+	}
+
+	return table, nil
+}
+
+func getBreakdownTable(state urlState, timeRange pageviews.TimeRange, title string, dimension pageviews.BreakdownDimension) (breakdownTable, error) {
+	limit := 10
+
+	table := breakdownTable{
+		Title: title,
+	}
+
+	breakdown, err := pageviews.GetBreakdown(state.selectedProjectID, timeRange, state.filters, dimension, limit)
+	if err != nil {
+		return table, err
+	}
+
+	for _, item := range breakdown {
+		record := breakdownTableRecord{
+			Name:       item.Name,
+			Views:      item.Views,
+			Visitors:   item.Visitors,
+			FilterLink: getFilterLink(state, string(dimension), item.Name),
+		}
+		table.Records = append(table.Records, record)
 	}
 
 	return table, nil
 }
+
+func getHomePageURL(state urlState) string {
+	query := url.Values{}
+	query.Set("project_id", state.selectedProjectID)
+	query.Set("daterange", string(state.selectedDateRange))
+	if state.selectedDateRange == components.CustomDateRange {
+		query.Set("from", state.selectedFrom)
+		query.Set("to", state.selectedTo)
+	}
+	query.Set("current_pageview_table_offset", state.currentPageViewTableOffset)
+	query.Set("current_source_table_offset", state.currentSourceTableOffset)
+	query.Set("current_event_table_offset", state.currentEventTableOffset)
+	if state.isComparing {
+		query.Set("compare", "true")
+	}
+	for _, filter := range filterNames {
+		value := getFilter(state.filters, filter.Key)
+		if value != "" {
+			query.Set(filter.Key, value)
+		}
+	}
+
+	return "/?" + query.Encode()
+}
+
+// Clicking a table row adds its value as a filter, replacing the filter on the same dimension
+func getFilterLink(state urlState, key string, value string) string {
+	filterState := getFirstPageState(state)
+	setFilter(&filterState.filters, key, value)
+	return getHomePageURL(filterState)
+}
+
+func getActiveFilters(state urlState) []activeFilter {
+	var activeFilters []activeFilter
+
+	for _, filter := range filterNames {
+		value := getFilter(state.filters, filter.Key)
+		if value == "" {
+			continue
+		}
+
+		activeFilters = append(activeFilters, activeFilter{
+			Key:        filter.Key,
+			Name:       filter.Name,
+			Value:      value,
+			RemoveLink: getFilterLink(state, filter.Key, ""),
+		})
+	}
+
+	return activeFilters
+}
+
+func getFilter(filters pageviews.Filters, key string) string {
+	switch key {
+	case "path":
+		return filters.Path
+	case "source":
+		return filters.Source
+	case "browser":
+		return filters.Browser
+	case "os":
+		return filters.OS
+	case "device_type":
+		return filters.DeviceType
+	case "event":
+		return filters.Event
+	}
+
+	return ""
+}
+
+func setFilter(filters *pageviews.Filters, key string, value string) {
+	switch key {
+	case "path":
+		filters.Path = value
+	case "source":
+		filters.Source = value
+	case "browser":
+		filters.Browser = value
+	case "os":
+		filters.OS = value
+	case "device_type":
+		filters.DeviceType = value
+	case "event":
+		filters.Event = value
+	}
+}
+
+// Switching the project or the date range starts the tables from their first page
+func getFirstPageState(state urlState) urlState {
+	state.currentPageViewTableOffset = "0"
+	state.currentSourceTableOffset = "0"
+	state.currentEventTableOffset = "0"
+	return state
+}
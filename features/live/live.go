@@ -0,0 +1,98 @@
+package live
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mouji/commons/components"
+	"mouji/commons/templates"
+	"mouji/features/pageviews"
+	"mouji/features/projects"
+	"net/http"
+	"time"
+)
+
+// Visitors drop off after a few minutes without a pageview, so the stream is refreshed even when there are no new ones
+var refreshInterval = 5 * time.Second
+
+func HandleLivePage(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("project_id")
+
+	project, err := projects.GetProjectByID(projectID)
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	renderLivePage(w, project, pageviews.GetLiveVisitors(projectID))
+}
+
+// Server-Sent Events stream of the project's current visitors, read by EventSource on the home and live pages
+func HandleLiveEvents(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("project_id")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	updates, unsubscribe := pageviews.SubscribeLiveVisitors(projectID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	lastData := ""
+	for {
+		data, err := json.Marshal(pageviews.GetLiveVisitors(projectID))
+		if err != nil {
+			err = fmt.Errorf("error encoding live visitors: %w", err)
+			slog.Error(err.Error())
+			return
+		}
+
+		if string(data) != lastData {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+			lastData = string(data)
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+func renderLivePage(w http.ResponseWriter, project projects.ProjectRecord, liveVisitors pageviews.LiveVisitorsRecord) {
+	type templateData struct {
+		Navbar       components.Navbar
+		ProjectID    string
+		ProjectName  string
+		LiveVisitors pageviews.LiveVisitorsRecord
+	}
+
+	tmplData := templateData{
+		Navbar:       components.NewNavbar(false),
+		ProjectID:    project.ProjectID,
+		ProjectName:  project.Name,
+		LiveVisitors: liveVisitors,
+	}
+
+	templates.Render(w, "live.html", tmplData)
+}
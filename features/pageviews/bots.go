@@ -0,0 +1,56 @@
+package pageviews
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+var botSignatures []string = nil
+
+// Signatures live in bot_signatures.txt so that new crawlers can be added without touching the code
+func LoadBotSignatures(resources embed.FS) {
+	content, err := fs.ReadFile(resources, "features/pageviews/bot_signatures.txt")
+	if err != nil {
+		err = fmt.Errorf("error reading bot signatures: %w", err)
+		panic(err)
+	}
+
+	var signatures []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		signatures = append(signatures, strings.ToLower(line))
+	}
+
+	botSignatures = signatures
+	slog.Info("loaded bot signatures", "count", len(botSignatures))
+}
+
+// Crawlers that execute JS still hit /collect, so apart from the UA patterns,
+// requests that lack the headers every browser sends are treated as bots
+func isBotRequest(r *http.Request) bool {
+	userAgent := r.Header.Get("User-Agent")
+
+	if strings.TrimSpace(userAgent) == "" {
+		return true
+	}
+
+	if r.Header.Get("Accept-Language") == "" {
+		return true
+	}
+
+	return isBotUserAgent(userAgent)
+}
+
+func isBotUserAgent(userAgent string) bool {
+	return containsAny(strings.ToLower(userAgent), botSignatures...)
+}
@@ -0,0 +1,158 @@
+package pageviews
+
+import (
+	"fmt"
+	"log/slog"
+	"mouji/commons/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var trustedProxies []netip.Prefix = nil
+var trustedProxiesMutex sync.RWMutex
+
+// Warned about once until the trusted proxies are changed, as every hit through the proxy would log it otherwise
+var hasWarnedUntrustedForwarding atomic.Bool
+
+// Reads the comma separated CIDRs from the config table, call again after they're changed in settings
+func LoadTrustedProxies() {
+	value, err := config.GetConfig("trusted_proxies")
+	if err != nil {
+		return
+	}
+
+	prefixes, err := ParseTrustedProxies(value)
+	if err != nil {
+		slog.Error("invalid trusted proxies in config, ignoring them", "error", err)
+		prefixes = nil
+	}
+
+	trustedProxiesMutex.Lock()
+	trustedProxies = prefixes
+	trustedProxiesMutex.Unlock()
+
+	hasWarnedUntrustedForwarding.Store(false)
+}
+
+// Accepts CIDRs like "10.0.0.0/8" and single addresses like "172.16.0.1"
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return prefixes, fmt.Errorf("invalid address %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return prefixes, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// Forwarding headers can be set by anyone, so they're only honoured when the immediate peer is a trusted proxy.
+// Fly-Client-IP and X-Real-IP are set by the proxy itself, X-Forwarded-For is walked from the right
+// as every proxy appends to it and the leftmost entries are whatever the client sent
+func getClientIP(r *http.Request) string {
+	peerIP := getPeerIP(r)
+
+	if !isTrustedProxy(peerIP) {
+		warnUntrustedForwarding(r, peerIP)
+		return peerIP
+	}
+
+	for _, header := range []string{"Fly-Client-IP", "X-Real-IP"} {
+		ip := strings.TrimSpace(r.Header.Get(header))
+		if isValidIP(ip) {
+			return ip
+		}
+	}
+
+	forwardedFor := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwardedFor[i])
+		if !isValidIP(ip) {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip
+		}
+	}
+
+	return peerIP
+}
+
+// Forwarding headers from a peer that isn't trusted usually mean the server is behind a proxy, like Fly's, that hasn't been added in settings
+func warnUntrustedForwarding(r *http.Request, peerIP string) {
+	if r.Header.Get("Fly-Client-IP") == "" && r.Header.Get("X-Forwarded-For") == "" {
+		return
+	}
+
+	if hasWarnedUntrustedForwarding.CompareAndSwap(false, true) {
+		slog.Warn("ignoring forwarding headers from a peer that isn't a trusted proxy, add the proxy's address in Settings > Trusted Proxies", "peer", peerIP)
+	}
+}
+
+// With no trusted proxies, a private or loopback client address is most likely a proxy's that every visitor shares
+func isUntrustedProxyIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	trustedProxiesMutex.RLock()
+	defer trustedProxiesMutex.RUnlock()
+
+	return len(trustedProxies) == 0 && (addr.IsPrivate() || addr.IsLoopback())
+}
+
+// RemoteAddr is "ip:port", the port changes for every connection so it's dropped
+func getPeerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	trustedProxiesMutex.RLock()
+	defer trustedProxiesMutex.RUnlock()
+
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isValidIP(ip string) bool {
+	_, err := netip.ParseAddr(ip)
+	return err == nil
+}
@@ -6,20 +6,52 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 )
 
 func HandleCollect(w http.ResponseWriter, r *http.Request) {
 	var record PageViewRecord
 
-	projectID := r.URL.Query().Get("project_id")
-	path := r.URL.Query().Get("path")
-	title := r.URL.Query().Get("title")
-	referrer := r.URL.Query().Get("referrer")
+	payload, err := parseCollectPayload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if isIPRateLimited(getClientIP(r), payload.ProjectID) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	project, statusCode, err := validateProject(r, payload.ProjectID)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	if isProjectRateLimited(payload.ProjectID) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	if project.ShouldRespectPrivacySignals && hasPrivacySignal(r, payload) {
+		return
+	}
+
+	projectID := payload.ProjectID
+	path := payload.Path
+	title := payload.Title
+	referrer := payload.Referrer
 	userAgent := r.Header.Get("User-Agent")
-	ipAddress := r.RemoteAddr
+	ipAddress := getClientIP(r)
+
+	visitorHash, err := generateVisitorHash(projectID, ipAddress, userAgent)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	visitorHash := generateVisitorHash(projectID, ipAddress, userAgent)
+	userAgentInfo := parseUserAgent(userAgent)
+	isBot := isBotRequest(r)
 
 	normalizedPath, err := normalizePath(path)
 	if err != nil {
@@ -27,6 +59,10 @@ func HandleCollect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if isDuplicateHit(visitorHash, normalizedPath) {
+		return
+	}
+
 	record = PageViewRecord{
 		ProjectID:   projectID,
 		Path:        normalizedPath,
@@ -34,13 +70,23 @@ func HandleCollect(w http.ResponseWriter, r *http.Request) {
 		Referrer:    referrer,
 		VisitorHash: visitorHash,
 		UserAgent:   userAgent,
+		Browser:     userAgentInfo.Browser,
+		OS:          userAgentInfo.OS,
+		DeviceType:  userAgentInfo.DeviceType,
+		IsBot:       isBot,
 	}
 
-	err = InsertPageView(record)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !enqueuePageView(record) {
+		forgetHit(visitorHash, normalizedPath)
+		recordRejection(projectID, QueueFullRejection, "")
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "server busy", http.StatusServiceUnavailable)
 		return
 	}
+
+	if !isBot {
+		publishLiveVisitor(record)
+	}
 }
 
 func normalizePath(rawURL string) (string, error) {
@@ -65,14 +111,16 @@ func normalizePath(rawURL string) (string, error) {
 // Generates a transient visitor hash that rotates daily
 // hash(daily_salt + website_domain + ip_address + user_agent)
 // https://news.ycombinator.com/item?id=24696768
-func generateVisitorHash(projectID string, ipAddress string, userAgent string) string {
-
-	dailySalt := time.Now().Format("2006-01-02")
+func generateVisitorHash(projectID string, ipAddress string, userAgent string) (string, error) {
+	dailySalt, err := getDailySalt(projectID)
+	if err != nil {
+		return "", err
+	}
 
 	// https://gobyexample.com/sha256-hashes
 	hash := sha256.New()
 	hash.Write([]byte(dailySalt + projectID + ipAddress + userAgent))
 	visitorHash := fmt.Sprintf("%x", hash.Sum(nil))
 
-	return visitorHash
+	return visitorHash, nil
 }
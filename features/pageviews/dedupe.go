@@ -0,0 +1,44 @@
+package pageviews
+
+import (
+	"sync"
+	"time"
+)
+
+var duplicateHitWindow = 5 * time.Second
+
+var recentHits = make(map[string]time.Time)
+var recentHitsLastPrunedAt = time.Now()
+var recentHitsMutex sync.Mutex
+
+// SPA routers can fire pushState and replaceState for the same route in quick succession,
+// so the same visitor hitting the same path within the window is counted only once
+func isDuplicateHit(visitorHash string, path string) bool {
+	recentHitsMutex.Lock()
+	defer recentHitsMutex.Unlock()
+
+	now := time.Now()
+	key := visitorHash + path
+
+	if now.Sub(recentHitsLastPrunedAt) > duplicateHitWindow {
+		for k, receivedAt := range recentHits {
+			if now.Sub(receivedAt) > duplicateHitWindow {
+				delete(recentHits, k)
+			}
+		}
+		recentHitsLastPrunedAt = now
+	}
+
+	receivedAt, exists := recentHits[key]
+	recentHits[key] = now
+
+	return exists && now.Sub(receivedAt) <= duplicateHitWindow
+}
+
+// Called when the hit couldn't be queued, so that the client's retry isn't dropped as a duplicate of it
+func forgetHit(visitorHash string, path string) {
+	recentHitsMutex.Lock()
+	defer recentHitsMutex.Unlock()
+
+	delete(recentHits, visitorHash+path)
+}
@@ -0,0 +1,114 @@
+package pageviews
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var maxEventNameLength = 128
+var maxEventPropertiesLength = 2048
+
+func HandleEventCollect(w http.ResponseWriter, r *http.Request) {
+	var record EventRecord
+
+	payload, err := parseCollectPayload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if isIPRateLimited(getClientIP(r), payload.ProjectID) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	project, statusCode, err := validateProject(r, payload.ProjectID)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	if isProjectRateLimited(payload.ProjectID) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	if project.ShouldRespectPrivacySignals && hasPrivacySignal(r, payload) {
+		return
+	}
+
+	projectID := payload.ProjectID
+	name := strings.TrimSpace(payload.Name)
+	properties := string(payload.Properties)
+	path := payload.Path
+	userAgent := r.Header.Get("User-Agent")
+	ipAddress := getClientIP(r)
+
+	visitorHash, err := generateVisitorHash(projectID, ipAddress, userAgent)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	isBot := isBotRequest(r)
+
+	err = validateEvent(name, properties)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if properties == "" {
+		properties = "{}"
+	}
+
+	normalizedPath, err := normalizePath(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	record = EventRecord{
+		ProjectID:   projectID,
+		Name:        name,
+		Properties:  properties,
+		Path:        normalizedPath,
+		VisitorHash: visitorHash,
+		IsBot:       isBot,
+	}
+
+	err = InsertEvent(record)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Properties are optional but when present should be a JSON object like {"plan": "pro"}
+func validateEvent(name string, properties string) error {
+	if name == "" {
+		return errors.New("event name should not be empty")
+	}
+
+	if len(name) > maxEventNameLength {
+		return errors.New("event name is too long")
+	}
+
+	if properties == "" {
+		return nil
+	}
+
+	if len(properties) > maxEventPropertiesLength {
+		return errors.New("event properties are too long")
+	}
+
+	var parsed map[string]any
+	err := json.Unmarshal([]byte(properties), &parsed)
+	if err != nil {
+		return errors.New("event properties should be a JSON object")
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package pageviews
+
+import (
+	"fmt"
+	"log/slog"
+	"mouji/commons/sqlite"
+)
+
+type EventRecord struct {
+	ProjectID   string
+	Name        string
+	Properties  string
+	Path        string
+	VisitorHash string
+	IsBot       bool
+}
+
+type PaginatedEventRecord struct {
+	Name         string
+	Count        int
+	Visitors     int
+	TotalRecords int
+}
+
+func InsertEvent(record EventRecord) error {
+	query := "INSERT INTO events (project_id, name, properties, path, visitor_hash, is_bot) VALUES (?, ?, ?, ?, ?, ?);"
+
+	_, err := sqlite.DB.Exec(query, record.ProjectID, record.Name, record.Properties, record.Path, record.VisitorHash, record.IsBot)
+	if err != nil {
+		err = fmt.Errorf("error inserting event: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func GetPaginatedEvents(projectID string, timeRange TimeRange, filters Filters, limit int, offset int) ([]PaginatedEventRecord, error) {
+	var records []PaginatedEventRecord
+
+	condition, conditionArgs := getVisitorFilterCondition(projectID, timeRange, filters)
+
+	query := `
+		SELECT
+			name,
+			COUNT(*) AS count,
+			COUNT(DISTINCT visitor_hash) AS visitors,
+			COUNT(*) OVER() AS total_rows
+		FROM
+			events
+		WHERE
+			project_id = ?
+			AND
+			received_at >= ?
+			AND
+			received_at < ?
+			AND
+			is_bot = 0` + condition + `
+		GROUP BY
+			name
+		ORDER BY
+			count DESC
+		LIMIT
+			?
+		OFFSET
+			?
+	`
+
+	args := append([]any{projectID, formatTime(timeRange.From), formatTime(timeRange.To)}, conditionArgs...)
+	args = append(args, limit, offset)
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		err = fmt.Errorf("error retrieving events: %w", err)
+		slog.Error(err.Error())
+		return records, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record PaginatedEventRecord
+		err = rows.Scan(&record.Name, &record.Count, &record.Visitors, &record.TotalRecords)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,104 @@
+package pageviews
+
+import (
+	"mouji/features/projects"
+	"strings"
+)
+
+// Dashboard filters, empty fields aren't filtered on
+type Filters struct {
+	Path       string
+	Source     string // As shown in the sources table, like "google.com", "direct" or "internal"
+	Browser    string
+	OS         string
+	DeviceType string
+	Event      string // Visitors who fired the event
+}
+
+func (filters Filters) IsEmpty() bool {
+	return filters.Path == "" && filters.Source == "" && filters.Browser == "" && filters.OS == "" && filters.DeviceType == "" && filters.Event == ""
+}
+
+// Hostname of the project's site, used to tell self-referrals apart
+func getProjectHost(projectID string) string {
+	project, err := projects.GetProjectByID(projectID)
+	if err != nil {
+		return ""
+	}
+
+	return normalizeHostname(project.BaseURL)
+}
+
+// Referrers are grouped by host, "https://www.google.com/search?q=mouji" becomes "google.com".
+// Empty referrers are grouped under "direct" and self-referrals from the project's site under "internal".
+// Params: project host, project host
+func getSourceExpression(column string) string {
+	remainder := "LOWER(CASE WHEN INSTR(" + column + ", '://') > 0 THEN SUBSTR(" + column + ", INSTR(" + column + ", '://') + 3) ELSE " + column + " END)"
+
+	// host ends at the first of "/", "?", "#" or ":"
+	separated := "REPLACE(REPLACE(REPLACE(" + remainder + ", '?', '/'), '#', '/'), ':', '/') || '/'"
+	host := "SUBSTR(" + separated + ", 1, INSTR(" + separated + ", '/') - 1)"
+
+	return `
+		CASE
+			WHEN ` + host + ` = '' THEN 'direct'
+			WHEN ` + host + ` = ? OR ` + host + ` = 'www.' || ? THEN 'internal'
+			WHEN ` + host + ` LIKE 'www.%' THEN SUBSTR(` + host + `, 5)
+			ELSE ` + host + `
+		END`
+}
+
+// Condition on the pageviews of the time range that match the filters, to be added after the WHERE clause of a query on pageviews.
+// Pageviews recorded before the user agent was classified are matched by "Unknown" like in the breakdown tables
+func getFilterCondition(projectID string, timeRange TimeRange, filters Filters) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if filters.Path != "" {
+		conditions = append(conditions, "path = ?")
+		args = append(args, filters.Path)
+	}
+	// The source expression is too slow to run on every pageview, so it's matched against the distinct referrers of the rollups instead.
+	// Referrers that only bots came from aren't rolled up, so they don't match
+	if filters.Source != "" {
+		projectHost := getProjectHost(projectID)
+		conditions = append(conditions, "referrer IN (SELECT referrer FROM ("+hourlyReferrerRollupsQuery+") WHERE "+getSourceExpression("referrer")+" = ?)")
+		args = append(args, getRollupArgs(projectID, timeRange)[:6]...)
+		args = append(args, projectHost, projectHost, filters.Source)
+	}
+	if filters.Browser != "" {
+		conditions = append(conditions, "COALESCE(browser, 'Unknown') = ?")
+		args = append(args, filters.Browser)
+	}
+	if filters.OS != "" {
+		conditions = append(conditions, "COALESCE(os, 'Unknown') = ?")
+		args = append(args, filters.OS)
+	}
+	if filters.DeviceType != "" {
+		conditions = append(conditions, "COALESCE(device_type, 'Unknown') = ?")
+		args = append(args, filters.DeviceType)
+	}
+	if filters.Event != "" {
+		conditions = append(conditions, "visitor_hash IN (SELECT visitor_hash FROM events WHERE project_id = ? AND received_at >= ? AND received_at < ? AND is_bot = 0 AND name = ?)")
+		args = append(args, projectID, formatTime(timeRange.From), formatTime(timeRange.To), filters.Event)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "\n\t\t\tAND\n\t\t\t" + strings.Join(conditions, "\n\t\t\tAND\n\t\t\t"), args
+}
+
+// Events and goals are filtered down to the visitors who have a pageview that matches the filters,
+// so that a filter on a path shows what the visitors of that path did and not only what they did on it
+func getVisitorFilterCondition(projectID string, timeRange TimeRange, filters Filters) (string, []any) {
+	if filters.IsEmpty() {
+		return "", nil
+	}
+
+	condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+	args := append([]any{projectID, formatTime(timeRange.From), formatTime(timeRange.To)}, conditionArgs...)
+	return "\n\t\t\tAND\n\t\t\tvisitor_hash IN (SELECT visitor_hash FROM pageviews WHERE project_id = ? AND received_at >= ? AND received_at < ? AND is_bot = 0" + condition + ")", args
+}
@@ -0,0 +1,72 @@
+package pageviews
+
+import (
+	"fmt"
+	"log/slog"
+	"mouji/commons/sqlite"
+	"mouji/features/projects"
+)
+
+type GoalConversionRecord struct {
+	Name        string
+	Completions int
+	Visitors    int
+}
+
+// Path goals are matched against pageviews and event goals against events, both exclude bots
+func GetGoalConversion(goal projects.GoalRecord, timeRange TimeRange, filters Filters) (GoalConversionRecord, error) {
+	record := GoalConversionRecord{
+		Name: goal.Name,
+	}
+
+	condition, conditionArgs := getVisitorFilterCondition(goal.ProjectID, timeRange, filters)
+
+	query := `
+		SELECT
+			COUNT(*) AS completions,
+			COUNT(DISTINCT visitor_hash) AS visitors
+		FROM
+			pageviews
+		WHERE
+			project_id = ?
+			AND
+			received_at >= ?
+			AND
+			received_at < ?
+			AND
+			is_bot = 0
+			AND
+			path GLOB ?` + condition + `
+	`
+
+	if goal.Type == projects.EventGoalType {
+		query = `
+			SELECT
+				COUNT(*) AS completions,
+				COUNT(DISTINCT visitor_hash) AS visitors
+			FROM
+				events
+			WHERE
+				project_id = ?
+				AND
+				received_at >= ?
+				AND
+				received_at < ?
+				AND
+				is_bot = 0
+				AND
+				name = ?` + condition + `
+		`
+	}
+
+	args := append([]any{goal.ProjectID, formatTime(timeRange.From), formatTime(timeRange.To), goal.Target}, conditionArgs...)
+	row := sqlite.DB.QueryRow(query, args...)
+	err := row.Scan(&record.Completions, &record.Visitors)
+	if err != nil {
+		err = fmt.Errorf("error retrieving goal conversion: %w", err)
+		slog.Error(err.Error())
+		return record, err
+	}
+
+	return record, nil
+}
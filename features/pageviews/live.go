@@ -0,0 +1,134 @@
+package pageviews
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var liveWindow = 5 * time.Minute
+
+type LiveVisitorsRecord struct {
+	Visitors int              `json:"visitors"`
+	Paths    []LivePathRecord `json:"paths"`
+}
+
+type LivePathRecord struct {
+	Path     string `json:"path"`
+	Visitors int    `json:"visitors"`
+}
+
+type liveVisitor struct {
+	path   string
+	seenAt time.Time
+}
+
+// Current visitors are kept in memory, fed by the collect endpoint, as the database only has the pageviews once the queue is flushed.
+// A visitor is on the path of their last pageview until they haven't been seen for liveWindow, so the counts start from zero after a restart
+var liveVisitors = make(map[string]map[string]liveVisitor) // project_id -> visitor_hash -> visitor
+var liveSubscribers = make(map[string]map[chan struct{}]bool)
+var isLiveStopped = false
+var liveMutex sync.Mutex
+
+func publishLiveVisitor(record PageViewRecord) {
+	liveMutex.Lock()
+	defer liveMutex.Unlock()
+
+	visitors, ok := liveVisitors[record.ProjectID]
+	if !ok {
+		visitors = make(map[string]liveVisitor)
+		liveVisitors[record.ProjectID] = visitors
+	}
+	visitors[record.VisitorHash] = liveVisitor{path: record.Path, seenAt: time.Now()}
+
+	pruneLiveVisitors(visitors)
+
+	// Subscribers that haven't picked up the last update yet get both in one
+	for subscriber := range liveSubscribers[record.ProjectID] {
+		select {
+		case subscriber <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func GetLiveVisitors(projectID string) LiveVisitorsRecord {
+	liveMutex.Lock()
+	defer liveMutex.Unlock()
+
+	record := LiveVisitorsRecord{Paths: []LivePathRecord{}}
+
+	visitors := liveVisitors[projectID]
+	pruneLiveVisitors(visitors)
+
+	pathVisitors := make(map[string]int)
+	for _, visitor := range visitors {
+		pathVisitors[visitor.path]++
+	}
+
+	for path, count := range pathVisitors {
+		record.Paths = append(record.Paths, LivePathRecord{Path: path, Visitors: count})
+	}
+	slices.SortFunc(record.Paths, func(a, b LivePathRecord) int {
+		if a.Visitors != b.Visitors {
+			return b.Visitors - a.Visitors
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	record.Visitors = len(visitors)
+
+	return record
+}
+
+// The channel receives a value whenever the project gets a pageview and is closed on shutdown
+func SubscribeLiveVisitors(projectID string) (chan struct{}, func()) {
+	liveMutex.Lock()
+	defer liveMutex.Unlock()
+
+	subscriber := make(chan struct{}, 1)
+	if isLiveStopped {
+		close(subscriber)
+		return subscriber, func() {}
+	}
+
+	if liveSubscribers[projectID] == nil {
+		liveSubscribers[projectID] = make(map[chan struct{}]bool)
+	}
+	liveSubscribers[projectID][subscriber] = true
+
+	unsubscribe := func() {
+		liveMutex.Lock()
+		defer liveMutex.Unlock()
+
+		if liveSubscribers[projectID][subscriber] {
+			delete(liveSubscribers[projectID], subscriber)
+			close(subscriber)
+		}
+	}
+
+	return subscriber, unsubscribe
+}
+
+// Server-Sent Events connections never go idle, so they're ended with this before the server waits for the in-flight requests
+func StopLiveVisitors() {
+	liveMutex.Lock()
+	defer liveMutex.Unlock()
+
+	isLiveStopped = true
+	for projectID, subscribers := range liveSubscribers {
+		for subscriber := range subscribers {
+			close(subscriber)
+		}
+		delete(liveSubscribers, projectID)
+	}
+}
+
+func pruneLiveVisitors(visitors map[string]liveVisitor) {
+	for visitorHash, visitor := range visitors {
+		if time.Since(visitor.seenAt) > liveWindow {
+			delete(visitors, visitorHash)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package pageviews
+
+import (
+	"fmt"
+	"math/rand"
+	"mouji/commons/sqlite"
+	"mouji/features/projects"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Size of the synthetic dataset, spread over the last seededDays for the benchmarked project and a second one
+// so that the queries have to skip over another project's rows like they would on a shared instance
+var seededPageViews = 1_000_000
+var seededEvents = 50_000
+var seededDays = 90
+var seededDailyVisitors = 4_000
+
+// A load of the home page, every query of the dashboard for one time range and set of filters, has to finish within these
+// on the seeded dataset. Unfiltered loads read the rollups and take about 1s for 3 months on a single core,
+// filtered loads read the raw pageviews of the time range and take 3 to 8s for 3 months
+var dashboardLoadBudget = 2 * time.Second
+var filteredDashboardLoadBudget = 12 * time.Second
+
+var seedOnce sync.Once
+var seededProjectID = ""
+
+type dashboardQuery struct {
+	name string
+	run  func(projectID string, timeRange TimeRange, filters Filters) error
+}
+
+// Same queries as the home page with the default table sizes
+var dashboardQueries = []dashboardQuery{
+	{"GetPageViewCountsByInterval", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetPageViewCountsByInterval(projectID, timeRange, filters)
+		return err
+	}},
+	{"GetVisitorCount", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetVisitorCount(projectID, timeRange, filters)
+		return err
+	}},
+	{"GetBotCount", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetBotCount(projectID, timeRange, filters)
+		return err
+	}},
+	{"GetPaginatedPageViews", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetPaginatedPageViews(projectID, timeRange, filters, 10, 0)
+		return err
+	}},
+	{"GetPaginatedSources", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetPaginatedSources(projectID, timeRange, filters, 10, 0)
+		return err
+	}},
+	{"GetBreakdown/browser", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetBreakdown(projectID, timeRange, filters, BrowserDimension, 10)
+		return err
+	}},
+	{"GetBreakdown/os", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetBreakdown(projectID, timeRange, filters, OSDimension, 10)
+		return err
+	}},
+	{"GetBreakdown/device_type", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetBreakdown(projectID, timeRange, filters, DeviceTypeDimension, 10)
+		return err
+	}},
+	{"GetPaginatedEvents", func(projectID string, timeRange TimeRange, filters Filters) error {
+		_, err := GetPaginatedEvents(projectID, timeRange, filters, 10, 0)
+		return err
+	}},
+}
+
+type dashboardFilter struct {
+	name    string
+	filters Filters
+}
+
+var dashboardFilters = []dashboardFilter{
+	{"unfiltered", Filters{}},
+	{"path", Filters{Path: "/posts/1"}},
+	{"source", Filters{Source: "news.ycombinator.com"}},
+	{"browser", Filters{Browser: "Firefox"}},
+}
+
+func TestMain(m *testing.M) {
+	dataFolder, err := os.MkdirTemp("", "mouji-test-")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Setenv("DATA_FOLDER", dataFolder)
+	sqlite.NewDB()
+	sqlite.Migrate(os.DirFS("../../migrations"))
+
+	code := m.Run()
+
+	sqlite.Close()
+	os.RemoveAll(dataFolder)
+	os.Exit(code)
+}
+
+func TestDashboardLoadLatency(t *testing.T) {
+	if os.Getenv("BENCHMARK_DASHBOARD") == "" {
+		t.Skip("seeds a large dataset, set BENCHMARK_DASHBOARD=1 to run")
+	}
+
+	projectID := seedDashboardData(t)
+
+	for _, timeRange := range getBenchmarkTimeRanges() {
+		for _, filter := range dashboardFilters {
+			// The first load warms up SQLite's page cache like the dashboard's previous loads would have
+			_, err := loadDashboard(projectID, timeRange.timeRange, filter.filters)
+			if err != nil {
+				t.Fatalf("%s %s: %v", timeRange.name, filter.name, err)
+			}
+
+			elapsed, err := loadDashboard(projectID, timeRange.timeRange, filter.filters)
+			if err != nil {
+				t.Fatalf("%s %s: %v", timeRange.name, filter.name, err)
+			}
+
+			var total time.Duration
+			for i, query := range dashboardQueries {
+				t.Logf("%s %s %s: %v", timeRange.name, filter.name, query.name, elapsed[i])
+				total += elapsed[i]
+			}
+
+			budget := dashboardLoadBudget
+			if !filter.filters.IsEmpty() {
+				budget = filteredDashboardLoadBudget
+			}
+
+			t.Logf("%s %s: %v", timeRange.name, filter.name, total)
+			if total > budget {
+				t.Errorf("%s %s dashboard took %v, over the budget of %v", timeRange.name, filter.name, total, budget)
+			}
+		}
+	}
+}
+
+func BenchmarkDashboardLoad(b *testing.B) {
+	projectID := seedDashboardData(b)
+
+	for _, timeRange := range getBenchmarkTimeRanges() {
+		for _, filter := range dashboardFilters {
+			b.Run(timeRange.name+"/"+filter.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := loadDashboard(projectID, timeRange.timeRange, filter.filters)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Runs the dashboard queries one after the other like the home page does, returns how long each took
+func loadDashboard(projectID string, timeRange TimeRange, filters Filters) ([]time.Duration, error) {
+	var elapsed []time.Duration
+
+	for _, query := range dashboardQueries {
+		start := time.Now()
+		err := query.run(projectID, timeRange, filters)
+		if err != nil {
+			return elapsed, fmt.Errorf("%s: %w", query.name, err)
+		}
+		elapsed = append(elapsed, time.Since(start))
+	}
+
+	return elapsed, nil
+}
+
+type benchmarkTimeRange struct {
+	name      string
+	timeRange TimeRange
+}
+
+// Same as the dashboard's 24h, 1m and 3m date ranges
+func getBenchmarkTimeRanges() []benchmarkTimeRange {
+	now := time.Now().UTC()
+	startOfToday := now.Truncate(24 * time.Hour)
+
+	return []benchmarkTimeRange{
+		{"24h", TimeRange{From: now.Truncate(time.Hour).Add(-23 * time.Hour), To: now.Truncate(time.Hour).Add(time.Hour), Location: time.UTC}},
+		{"1m", TimeRange{From: startOfToday.AddDate(0, -1, 1), To: startOfToday.AddDate(0, 0, 1), Location: time.UTC}},
+		{"3m", TimeRange{From: startOfToday.AddDate(0, -3, 1), To: startOfToday.AddDate(0, 0, 1), Location: time.UTC}},
+	}
+}
+
+// Seeds the pageviews and events once per test binary and rolls up the completed hours like the background task does
+func seedDashboardData(tb testing.TB) string {
+	tb.Helper()
+
+	seedOnce.Do(func() {
+		start := time.Now()
+
+		project, err := projects.InsertProject("Benchmark", "https://www.example.com")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		otherProject, err := projects.InsertProject("Other", "https://other.example.com")
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		random := rand.New(rand.NewSource(1))
+		now := time.Now().UTC()
+
+		err = seedPageViews(random, project.ProjectID, otherProject.ProjectID, now)
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		err = seedEvents(random, project.ProjectID, now)
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		err = rollupHours(now.AddDate(0, 0, -seededDays-1).Format(rollupHourFormat), now.Add(-rollupDelay).Truncate(time.Hour).Format(rollupHourFormat))
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		seededProjectID = project.ProjectID
+		tb.Logf("seeded %d pageviews and %d events in %v", seededPageViews, seededEvents, time.Since(start))
+	})
+
+	if seededProjectID == "" {
+		tb.Fatal("seeding failed in an earlier test")
+	}
+
+	return seededProjectID
+}
+
+func seedPageViews(random *rand.Rand, projectID string, otherProjectID string, now time.Time) error {
+	browsers := []string{"Chrome", "Safari", "Firefox", "Edge", "Other"}
+	oses := []string{"Windows", "macOS", "iOS", "Android", "Linux"}
+	deviceTypes := []string{"Desktop", "Mobile", "Tablet"}
+	referrers := []string{"https://www.google.com/search", "https://news.ycombinator.com/item", "https://t.co/abc", "https://www.reddit.com/r/golang", "https://duckduckgo.com/", "https://www.example.com/posts/2"}
+
+	// A few pages get most of the views, like on a blog
+	paths := rand.NewZipf(random, 1.2, 1, 499)
+
+	// Inserted in the order they're received like the ingestion queue does, so that the rows of a time range are close together
+	span := time.Duration(seededDays) * 24 * time.Hour
+	step := span / time.Duration(seededPageViews)
+
+	var batch []PageViewRecord
+	for i := 0; i < seededPageViews; i++ {
+		record := PageViewRecord{
+			ProjectID:  projectID,
+			Path:       fmt.Sprintf("/posts/%d", paths.Uint64()),
+			Browser:    browsers[random.Intn(len(browsers))],
+			OS:         oses[random.Intn(len(oses))],
+			DeviceType: deviceTypes[random.Intn(len(deviceTypes))],
+			IsBot:      random.Intn(20) == 0,
+			ReceivedAt: now.Add(-span + time.Duration(i)*step).Format(time.DateTime),
+		}
+		if i%10 == 0 {
+			record.ProjectID = otherProjectID
+		}
+		record.Title = "Post " + record.Path
+		record.VisitorHash = fmt.Sprintf("%s-%d", record.ReceivedAt[:10], random.Intn(seededDailyVisitors))
+		if random.Intn(2) == 0 {
+			record.Referrer = referrers[random.Intn(len(referrers))]
+		}
+
+		batch = append(batch, record)
+		if len(batch) == 10_000 {
+			err := InsertPageViews(batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	return InsertPageViews(batch)
+}
+
+func seedEvents(random *rand.Rand, projectID string, now time.Time) error {
+	names := []string{"signup", "download", "subscribe", "share"}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO events (project_id, name, properties, path, visitor_hash, is_bot, received_at) VALUES (?, ?, '{}', ?, ?, 0, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	span := time.Duration(seededDays) * 24 * time.Hour
+	step := span / time.Duration(seededEvents)
+
+	for i := 0; i < seededEvents; i++ {
+		receivedAt := now.Add(-span + time.Duration(i)*step).Format(time.DateTime)
+		visitorHash := fmt.Sprintf("%s-%d", receivedAt[:10], random.Intn(seededDailyVisitors))
+
+		_, err = stmt.Exec(projectID, names[random.Intn(len(names))], fmt.Sprintf("/posts/%d", random.Intn(500)), visitorHash, receivedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
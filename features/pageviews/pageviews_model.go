@@ -1,10 +1,9 @@
 package pageviews
 
 import (
-	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log/slog"
-	"mouji/commons/components"
 	"mouji/commons/sqlite"
 	"slices"
 )
@@ -16,27 +15,84 @@ type PageViewRecord struct {
 	Referrer    string
 	VisitorHash string
 	UserAgent   string
+	Browser     string
+	OS          string
+	DeviceType  string
+	IsBot       bool
+	ReceivedAt  string
 }
 
 type PaginatedPageViewRecord struct {
 	Title        string
 	Path         string
 	Views        int
+	Visitors     int
 	TotalRecords int
 }
 
+type PaginatedSourceRecord struct {
+	Source       string
+	Views        int
+	TotalRecords int
+}
+
+type BreakdownRecord struct {
+	Name     string
+	Views    int
+	Visitors int
+}
+
+type BreakdownDimension string
+
+const (
+	BrowserDimension    BreakdownDimension = "browser"
+	OSDimension         BreakdownDimension = "os"
+	DeviceTypeDimension BreakdownDimension = "device_type"
+)
+
+// The dimensions are interpolated into the queries, so only these column names are allowed
+var breakdownDimensions = []BreakdownDimension{BrowserDimension, OSDimension, DeviceTypeDimension}
+
 type PageViewCountRecord struct {
+	Position   int // Index of the interval in the time range
 	Interval   string
 	Count      int
+	Visitors   int
 	TotalCount int
 }
 
-func InsertPageView(record PageViewRecord) error {
-	query := "INSERT INTO pageviews (project_id, path, title, referrer, visitor_hash, user_agent) VALUES (?, ?, ?, ?, ?, ?);"
+// Inserts the batch in a single transaction, either all the pageviews are written or none
+func InsertPageViews(records []PageViewRecord) error {
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		err = fmt.Errorf("error starting pageviews transaction: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO pageviews (project_id, path, title, referrer, visitor_hash, user_agent, browser, os, device_type, is_bot, received_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);"
 
-	_, err := sqlite.DB.Exec(query, record.ProjectID, record.Path, record.Title, record.Referrer, record.VisitorHash, record.UserAgent)
+	stmt, err := tx.Prepare(query)
 	if err != nil {
-		err = fmt.Errorf("error inserting pageview: %w", err)
+		err = fmt.Errorf("error preparing pageview insert: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+	defer stmt.Close()
+
+	for _, record := range records {
+		_, err = stmt.Exec(record.ProjectID, record.Path, record.Title, record.Referrer, record.VisitorHash, record.UserAgent, record.Browser, record.OS, record.DeviceType, record.IsBot, record.ReceivedAt)
+		if err != nil {
+			err = fmt.Errorf("error inserting pageview: %w", err)
+			slog.Error(err.Error())
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = fmt.Errorf("error committing pageviews: %w", err)
 		slog.Error(err.Error())
 		return err
 	}
@@ -44,21 +100,21 @@ func InsertPageView(record PageViewRecord) error {
 	return nil
 }
 
-func GetPaginatedPageViews(projectID string, daterange components.DataRangeType, limit int, offset int) ([]PaginatedPageViewRecord, error) {
+func GetPaginatedPageViews(projectID string, timeRange TimeRange, filters Filters, limit int, offset int) ([]PaginatedPageViewRecord, error) {
 	var records []PaginatedPageViewRecord
 
+	pathCountsQuery, args := getHourlyPathCounts(projectID, timeRange, filters)
+
 	query := `
+		WITH paths AS (` + pathCountsQuery + `)
 		SELECT
-			title,
+			MAX(title),
 			path,
-			COUNT(*) AS views,
+			SUM(views) AS views,
+			SUM(new_visitors) AS visitors,
 			COUNT(*) OVER() AS total_rows
 		FROM
-			pageviews 
-		WHERE
-			project_id = ?
-			AND
-			received_at >= DATETIME('now', ?)
+			paths
 		GROUP BY
 			path
 		ORDER BY
@@ -69,7 +125,42 @@ func GetPaginatedPageViews(projectID string, daterange components.DataRangeType,
 			?
 	`
 
-	rows, err := sqlite.DB.Query(query, projectID, getDateRangeFilter(daterange), limit, offset)
+	// new_visitors counts a visitor in the hour of their first hit of the UTC day, which can be before a range that starts mid-day,
+	// so hourly ranges count the distinct visitors of the raw rows like GetVisitorCount
+	if getInterval(timeRange) == HourlyInterval {
+		condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+		query = `
+			SELECT
+				MAX(title),
+				path,
+				COUNT(*) AS views,
+				COUNT(DISTINCT visitor_hash) AS visitors,
+				COUNT(*) OVER() AS total_rows
+			FROM
+				pageviews
+			WHERE
+				project_id = ?
+				AND
+				received_at >= ?
+				AND
+				received_at < ?
+				AND
+				is_bot = 0` + condition + `
+			GROUP BY
+				path
+			ORDER BY
+				views DESC
+			LIMIT
+				?
+			OFFSET
+				?
+		`
+		args = append([]any{projectID, formatTime(timeRange.From), formatTime(timeRange.To)}, conditionArgs...)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := sqlite.DB.Query(query, args...)
 	if err != nil {
 		err = fmt.Errorf("error retrieving pageviews: %w", err)
 		slog.Error(err.Error())
@@ -79,7 +170,7 @@ func GetPaginatedPageViews(projectID string, daterange components.DataRangeType,
 
 	for rows.Next() {
 		var record PaginatedPageViewRecord
-		err = rows.Scan(&record.Title, &record.Path, &record.Views, &record.TotalRecords)
+		err = rows.Scan(&record.Title, &record.Path, &record.Views, &record.Visitors, &record.TotalRecords)
 		if err != nil {
 			return records, err
 		}
@@ -89,78 +180,234 @@ func GetPaginatedPageViews(projectID string, daterange components.DataRangeType,
 	return records, nil
 }
 
-func GetPageViewCountsByInterval(projectID string, daterange components.DataRangeType) ([]PageViewCountRecord, error) {
-	var records []PageViewCountRecord
-	var rows *sql.Rows
-	var err error
+// Views of the given paths, used to compare the rows of the top pages table against another time range
+func GetPageViewsByPath(projectID string, timeRange TimeRange, filters Filters, paths []string) (map[string]int, error) {
+	views := make(map[string]int)
 
-	if daterange == "24h" {
-		query := `
+	encodedPaths, err := json.Marshal(paths)
+	if err != nil {
+		err = fmt.Errorf("error encoding paths: %w", err)
+		slog.Error(err.Error())
+		return views, err
+	}
+
+	pathCountsQuery, args := getHourlyPathCounts(projectID, timeRange, filters)
+
+	query := `
+		WITH paths AS (` + pathCountsQuery + `)
+		SELECT
+			path,
+			SUM(views) AS views
+		FROM
+			paths
+		WHERE
+			path IN (SELECT value FROM json_each(?))
+		GROUP BY
+			path
+	`
+
+	args = append(args, string(encodedPaths))
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		err = fmt.Errorf("error retrieving pageviews by path: %w", err)
+		slog.Error(err.Error())
+		return views, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path string
+		var count int
+		err = rows.Scan(&path, &count)
+		if err != nil {
+			return views, err
+		}
+		views[path] = count
+	}
+
+	return views, nil
+}
+
+// Groups referrers into sources, see getSourceExpression
+func GetPaginatedSources(projectID string, timeRange TimeRange, filters Filters, limit int, offset int) ([]PaginatedSourceRecord, error) {
+	var records []PaginatedSourceRecord
+
+	referrerCountsQuery, args := getHourlyReferrerCounts(projectID, timeRange, filters)
+
+	query := `
+		WITH referrers AS (` + referrerCountsQuery + `),
+		sources AS (
 			SELECT
-				-- https://stackoverflow.com/a/33116186
-				STRFTIME('%d ', received_at) || SUBSTR('--JanFebMarAprMayJunJulAugSepOctNovDec', STRFTIME('%m', received_at) * 3, 3) || ', ' ||
-					CASE 
-						WHEN STRFTIME('%H', received_at) = '00' THEN '12 - 01 AM'
-						WHEN STRFTIME('%H', received_at) = '12' THEN '12 - 01 PM'
-						ELSE
-							STRFTIME('%I', received_at) || ' - ' || STRFTIME('%I', DATETIME(received_at, '+1 hour')) || 
-								CASE 
-									WHEN STRFTIME('%p', received_at) = 'AM' AND STRFTIME('%H', received_at) = '11' THEN ' PM'
-									WHEN STRFTIME('%p', received_at) = 'PM' AND STRFTIME('%H', received_at) = '23' THEN ' AM'
-									ELSE STRFTIME(' %p', received_at)
-								END
-					END AS interval,
-				COUNT(*) AS count, 
-				SUM(COUNT(*)) OVER() AS total_count
+				` + getSourceExpression("referrer") + ` AS source,
+				views
 			FROM
-				pageviews
-			WHERE
-				project_id = ?
-				AND
-				received_at >= DATETIME('now', '-24 hours')
-			GROUP BY
-				STRFTIME('%Y-%m-%d %H', received_at)
-			ORDER BY
-				STRFTIME('%Y-%m-%d %H', received_at);
-		`
-		rows, err = sqlite.DB.Query(query, projectID)
-	} else if daterange == "1w" || daterange == "1m" || daterange == "3m" {
-		query := `
+				referrers
+		)
+		SELECT
+			source,
+			SUM(views) AS views,
+			COUNT(*) OVER() AS total_rows
+		FROM
+			sources
+		GROUP BY
+			source
+		ORDER BY
+			views DESC
+		LIMIT
+			?
+		OFFSET
+			?
+	`
+
+	projectHost := getProjectHost(projectID)
+	args = append(args, projectHost, projectHost, limit, offset)
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		err = fmt.Errorf("error retrieving sources: %w", err)
+		slog.Error(err.Error())
+		return records, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record PaginatedSourceRecord
+		err = rows.Scan(&record.Source, &record.Views, &record.TotalRecords)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Pageviews recorded before the user agent was classified are grouped under "Unknown"
+func GetBreakdown(projectID string, timeRange TimeRange, filters Filters, dimension BreakdownDimension, limit int) ([]BreakdownRecord, error) {
+	var records []BreakdownRecord
+
+	if !slices.Contains(breakdownDimensions, dimension) {
+		return records, fmt.Errorf("invalid breakdown dimension: %s", dimension)
+	}
+
+	breakdownCountsQuery, args := getHourlyBreakdownCounts(projectID, timeRange, dimension)
+
+	query := `
+		WITH breakdown AS (` + breakdownCountsQuery + `)
+		SELECT
+			name,
+			SUM(views) AS views,
+			SUM(new_visitors) AS visitors
+		FROM
+			breakdown
+		GROUP BY
+			name
+		ORDER BY
+			views DESC
+		LIMIT
+			?
+	`
+
+	// Rollups only have totals, and new_visitors can count a visitor before a range that starts mid-day,
+	// so filtered breakdowns and hourly ranges count the distinct visitors of the raw rows
+	if !filters.IsEmpty() || getInterval(timeRange) == HourlyInterval {
+		condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+		query = fmt.Sprintf(`
 			SELECT
-				STRFTIME('%d ', received_at) || SUBSTR('--JanFebMarAprMayJunJulAugSepOctNovDec', STRFTIME('%m', received_at) * 3, 3) AS interval,
-				COUNT(*) AS count, 
-				SUM(COUNT(*)) OVER() AS total_count
+				COALESCE(%s, 'Unknown') AS name,
+				COUNT(*) AS views,
+				COUNT(DISTINCT visitor_hash) AS visitors
 			FROM
 				pageviews
 			WHERE
 				project_id = ?
 				AND
-				received_at >= DATETIME('now', ?)
-			GROUP BY
-				interval
-			ORDER BY
-				received_at
-		`
-		rows, err = sqlite.DB.Query(query, projectID, getDateRangeFilter(daterange))
-	} else {
-		query := `
-			SELECT
-				STRFTIME('%Y ', received_at) || SUBSTR('--JanFebMarAprMayJunJulAugSepOctNovDec', STRFTIME('%m', received_at) * 3, 3) AS interval,
-				COUNT(*) AS count, 
-				SUM(COUNT(*)) OVER() AS total_count
-			FROM
-				pageviews
-			WHERE
-				project_id = ?
+				received_at >= ?
+				AND
+				received_at < ?
 				AND
-				received_at >= DATETIME('now', '-1 years')
+				is_bot = 0%s
 			GROUP BY
-				interval
+				name
 			ORDER BY
-				received_at
-		`
-		rows, err = sqlite.DB.Query(query, projectID, getDateRangeFilter(daterange))
+				views DESC
+			LIMIT
+				?
+		`, dimension, condition)
+		args = append([]any{projectID, formatTime(timeRange.From), formatTime(timeRange.To)}, conditionArgs...)
+	}
+
+	args = append(args, limit)
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		err = fmt.Errorf("error retrieving %s breakdown: %w", dimension, err)
+		slog.Error(err.Error())
+		return records, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record BreakdownRecord
+		err = rows.Scan(&record.Name, &record.Views, &record.Visitors)
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Buckets are generated in Go as the timezone database isn't available to SQLite, and passed in as a JSON array.
+// Every bucket of the time range is returned, the ones without pageviews with zero counts so that gaps show up on the chart.
+// Daily and monthly visitors are summed from new_visitors, which counts visitors by their first hit of the UTC day,
+// so in other timezones a visitor is counted in the local day of their first hit of the UTC day,
+// and one whose local day spans two UTC days can be counted twice in it
+func GetPageViewCountsByInterval(projectID string, timeRange TimeRange, filters Filters) ([]PageViewCountRecord, error) {
+	var records []PageViewCountRecord
+
+	visitorsColumn := "new_visitors"
+	if getInterval(timeRange) == HourlyInterval {
+		visitorsColumn = "visitors"
+	}
+
+	buckets, err := json.Marshal(getBuckets(timeRange))
+	if err != nil {
+		err = fmt.Errorf("error encoding buckets: %w", err)
+		slog.Error(err.Error())
+		return records, err
 	}
+
+	countsQuery, args := getHourlyCounts(projectID, timeRange, filters)
+
+	query := `
+		WITH hourly AS (` + countsQuery + `),
+		buckets AS (
+			SELECT
+				key AS position,
+				json_extract(value, '$.start') AS bucket_start,
+				json_extract(value, '$.end') AS bucket_end,
+				json_extract(value, '$.label') AS label
+			FROM
+				json_each(?)
+		)
+		SELECT
+			position,
+			label AS interval,
+			COALESCE(SUM(views), 0) AS count,
+			COALESCE(SUM(` + visitorsColumn + `), 0) AS visitors,
+			COALESCE(SUM(SUM(views)) OVER(), 0) AS total_count
+		FROM
+			buckets
+			LEFT JOIN hourly ON hour >= bucket_start AND hour < bucket_end
+		GROUP BY
+			position
+		ORDER BY
+			position
+	`
+
+	args = append(args, string(buckets))
+	rows, err := sqlite.DB.Query(query, args...)
 	if err != nil {
 		err = fmt.Errorf("error retrieving pageview counts: %w", err)
 		slog.Error(err.Error())
@@ -170,7 +417,7 @@ func GetPageViewCountsByInterval(projectID string, daterange components.DataRang
 
 	for rows.Next() {
 		var record PageViewCountRecord
-		err = rows.Scan(&record.Interval, &record.Count, &record.TotalCount)
+		err = rows.Scan(&record.Position, &record.Interval, &record.Count, &record.Visitors, &record.TotalCount)
 		if err != nil {
 			return records, err
 		}
@@ -180,23 +427,83 @@ func GetPageViewCountsByInterval(projectID string, daterange components.DataRang
 	return records, nil
 }
 
-func getDateRangeFilter(daterange components.DataRangeType) string {
-	if !slices.Contains(components.DateRangeValues, daterange) {
-		daterange = components.DateRangeValues[0]
+// Visitors can't be summed across intervals as the same visitor can show up in multiple intervals
+// Ranges short enough for an hourly chart, like the last 24 hours, are counted from the raw rows,
+// as new_visitors would miss the visitors whose first hit of the UTC day was before the range.
+// Longer ranges are summed from the rollups, where that only affects the first day in timezones other than UTC
+func GetVisitorCount(projectID string, timeRange TimeRange, filters Filters) (int, error) {
+	count := 0
+
+	countsQuery, args := getHourlyCounts(projectID, timeRange, filters)
+
+	query := `
+		WITH hourly AS (` + countsQuery + `)
+		SELECT
+			COALESCE(SUM(new_visitors), 0)
+		FROM
+			hourly
+	`
+
+	if getInterval(timeRange) == HourlyInterval {
+		condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+		query = `
+			SELECT
+				COUNT(DISTINCT visitor_hash)
+			FROM
+				pageviews
+			WHERE
+				project_id = ?
+				AND
+				received_at >= ?
+				AND
+				received_at < ?
+				AND
+				is_bot = 0` + condition + `
+		`
+		args = append([]any{projectID, formatTime(timeRange.From), formatTime(timeRange.To)}, conditionArgs...)
 	}
 
-	switch daterange {
-	case "24h":
-		return "-24 hours"
-	case "1w":
-		return "-6 days"
-	case "1m":
-		return "-1 months"
-	case "3m":
-		return "-3 months"
-	case "1y":
-		return "-1 years"
+	row := sqlite.DB.QueryRow(query, args...)
+	err := row.Scan(&count)
+	if err != nil {
+		err = fmt.Errorf("error retrieving visitor count: %w", err)
+		slog.Error(err.Error())
+		return count, err
+	}
+
+	return count, nil
+}
+
+// Bots are excluded from every other query, this is the only place they're counted
+func GetBotCount(projectID string, timeRange TimeRange, filters Filters) (int, error) {
+	count := 0
+
+	condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+	query := `
+		SELECT
+			COUNT(*)
+		FROM
+			pageviews
+		WHERE
+			project_id = ?
+			AND
+			received_at >= ?
+			AND
+			received_at < ?
+			AND
+			is_bot = 1` + condition + `
+	`
+
+	args := append([]any{projectID, formatTime(timeRange.From), formatTime(timeRange.To)}, conditionArgs...)
+	row := sqlite.DB.QueryRow(query, args...)
+	err := row.Scan(&count)
+	if err != nil {
+		err = fmt.Errorf("error retrieving bot count: %w", err)
+		slog.Error(err.Error())
+		return count, err
 	}
 
-	return "-24 hours"
+	return count, nil
 }
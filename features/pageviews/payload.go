@@ -0,0 +1,57 @@
+package pageviews
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var maxPayloadSize int64 = 16 * 1024 // 16 KB
+
+// Shared by pageviews and events, the fields that don't apply to one are left empty
+type collectPayload struct {
+	ProjectID  string          `json:"project_id"`
+	Path       string          `json:"path"`
+	Title      string          `json:"title"`
+	Referrer   string          `json:"referrer"`
+	Name       string          `json:"name"`
+	Properties json.RawMessage `json:"props"`
+	// Set by the tracker from navigator.doNotTrack and navigator.globalPrivacyControl,
+	// as some privacy extensions only expose the signal to JS and not as a header
+	DoNotTrack           bool `json:"dnt"`
+	GlobalPrivacyControl bool `json:"gpc"`
+}
+
+// GET requests carry the payload as query params while POST requests carry it as a JSON body.
+// The tracker posts with navigator.sendBeacon which uses text/plain to avoid the CORS preflight,
+// so the body is parsed as JSON regardless of the Content-Type
+func parseCollectPayload(w http.ResponseWriter, r *http.Request) (collectPayload, error) {
+	var payload collectPayload
+
+	if r.Method != http.MethodPost {
+		query := r.URL.Query()
+		payload.ProjectID = query.Get("project_id")
+		payload.Path = query.Get("path")
+		payload.Title = query.Get("title")
+		payload.Referrer = query.Get("referrer")
+		payload.Name = query.Get("name")
+		payload.DoNotTrack = query.Get("dnt") == "1"
+		payload.GlobalPrivacyControl = query.Get("gpc") == "1"
+		if query.Get("props") != "" {
+			payload.Properties = json.RawMessage(query.Get("props"))
+		}
+		return payload, nil
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxPayloadSize)
+	err := json.NewDecoder(body).Decode(&payload)
+	if err != nil {
+		return payload, errors.New("payload should be a JSON object")
+	}
+
+	if string(payload.Properties) == "null" {
+		payload.Properties = nil
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,27 @@
+package pageviews
+
+import (
+	"net/http"
+)
+
+// Projects can opt in to skip hits from visitors who opted out of tracking, the skipped hits
+// are counted as rejections so that the excluded traffic remains visible in Settings
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/DNT
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Sec-GPC
+func hasPrivacySignal(r *http.Request, payload collectPayload) bool {
+	signal := ""
+
+	switch {
+	case r.Header.Get("Sec-GPC") == "1" || payload.GlobalPrivacyControl:
+		signal = "Sec-GPC"
+	case r.Header.Get("DNT") == "1" || payload.DoNotTrack:
+		signal = "DNT"
+	}
+
+	if signal == "" {
+		return false
+	}
+
+	recordRejection(payload.ProjectID, PrivacySignalRejection, signal)
+	return true
+}
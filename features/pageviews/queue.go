@@ -0,0 +1,119 @@
+package pageviews
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var queueSize = 10_000
+var flushBatchSize = 500
+var flushInterval = time.Second
+var maxFlushAttempts = 3
+
+var pageViewQueue chan PageViewRecord = nil
+var pageViewQueueDone chan struct{} = nil
+var isPageViewQueueStopped = false
+var pageViewQueueMutex sync.RWMutex
+
+// Pageviews are queued and written in batches, so that a traffic spike results in a few
+// large transactions instead of every request waiting for SQLite's writer lock
+func StartIngestionQueue() {
+	pageViewQueue = make(chan PageViewRecord, queueSize)
+	pageViewQueueDone = make(chan struct{})
+
+	go runIngestionQueue()
+}
+
+// Stops accepting pageviews and returns once the queued ones are written
+func StopIngestionQueue() {
+	pageViewQueueMutex.Lock()
+	isPageViewQueueStopped = true
+	close(pageViewQueue)
+	pageViewQueueMutex.Unlock()
+
+	<-pageViewQueueDone
+}
+
+// Returns false when the queue is full or stopped so that the caller can ask the client to back off
+func enqueuePageView(record PageViewRecord) bool {
+	record.ReceivedAt = time.Now().UTC().Format(time.DateTime)
+
+	pageViewQueueMutex.RLock()
+	defer pageViewQueueMutex.RUnlock()
+
+	if isPageViewQueueStopped {
+		return false
+	}
+
+	select {
+	case pageViewQueue <- record:
+		return true
+	default:
+		return false
+	}
+}
+
+func runIngestionQueue() {
+	var batch []PageViewRecord
+	// A batch that failed to write is kept apart from the pageviews queued since, so that those get their own attempts
+	var failedBatch []PageViewRecord
+	attempts := 0
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	// A failed batch is retried on the next tick before the new pageviews are written,
+	// SQLite only fails writes here when it's busy or out of disk
+	flush := func() {
+		if len(failedBatch) > 0 {
+			err := InsertPageViews(failedBatch)
+			attempts++
+			if err != nil && attempts < maxFlushAttempts {
+				return
+			}
+			if err != nil {
+				slog.Error("dropping pageviews after repeated write failures", "count", len(failedBatch))
+			}
+
+			failedBatch = nil
+			attempts = 0
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+
+		err := InsertPageViews(batch)
+		if err != nil {
+			failedBatch = batch
+			attempts = 1
+		}
+
+		batch = nil
+	}
+
+	for {
+		select {
+		case record, ok := <-pageViewQueue:
+			if !ok {
+				// Retries wait like they would on the ticker, so that a busy database gets time to recover
+				flush()
+				for len(batch) > 0 || len(failedBatch) > 0 {
+					time.Sleep(flushInterval)
+					flush()
+				}
+				close(pageViewQueueDone)
+				return
+			}
+
+			// While a failed batch waits for its retry, the new pageviews wait for the ticker too
+			batch = append(batch, record)
+			if len(batch) >= flushBatchSize && len(failedBatch) == 0 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package pageviews
+
+import (
+	"log/slog"
+	"mouji/commons/config"
+	"mouji/commons/ratelimit"
+	"strconv"
+)
+
+var DefaultIPRateLimit = 120         // requests per minute
+var DefaultProjectRateLimit = 12_000 // requests per minute
+
+var ipLimiter = ratelimit.NewLimiter(DefaultIPRateLimit)
+var projectLimiter = ratelimit.NewLimiter(DefaultProjectRateLimit)
+
+// Reads the limits from the config table, call again after they're changed in settings
+func LoadRateLimits() {
+	ipLimiter.SetRate(GetRateLimit("rate_limit_per_ip", DefaultIPRateLimit))
+	projectLimiter.SetRate(GetRateLimit("rate_limit_per_project", DefaultProjectRateLimit))
+}
+
+func GetRateLimit(key string, defaultLimit int) int {
+	value, err := config.GetConfig(key)
+	if err != nil || value == "" {
+		return defaultLimit
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		slog.Error("invalid rate limit in config, using default", "key", key, "value", value)
+		return defaultLimit
+	}
+
+	return limit
+}
+
+// Checked before the project is validated so that a single client can't use up the project's budget or flood the lookups.
+// The project_id isn't validated yet, so it's recorded as the detail like unknown projects are
+func isIPRateLimited(ipAddress string, projectID string) bool {
+	// Behind a proxy that isn't trusted yet, all visitors would share the proxy's bucket and the whole site would be throttled
+	if isUntrustedProxyIP(ipAddress) {
+		return false
+	}
+
+	if !ipLimiter.Allow(ipAddress) {
+		recordRejection("", IPRateLimitRejection, projectID)
+		return true
+	}
+
+	return false
+}
+
+// Checked after the project is validated so that made-up project IDs don't each get a bucket
+func isProjectRateLimited(projectID string) bool {
+	if !projectLimiter.Allow(projectID) {
+		recordRejection(projectID, ProjectRateLimitRejection, "")
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package pageviews
+
+import (
+	"sort"
+	"sync"
+)
+
+type RejectionReason string
+
+const (
+	UnknownProjectRejection   RejectionReason = "Unknown project"
+	OriginMismatchRejection   RejectionReason = "Origin not allowed"
+	IPRateLimitRejection      RejectionReason = "Rate limited per IP"
+	ProjectRateLimitRejection RejectionReason = "Rate limited per project"
+	PrivacySignalRejection    RejectionReason = "Opted out via privacy signal"
+	QueueFullRejection        RejectionReason = "Ingestion queue full"
+)
+
+// Detail holds what was rejected, like the unknown project_id or the origin's hostname
+type RejectionRecord struct {
+	ProjectID string
+	Reason    RejectionReason
+	Detail    string
+	Count     int
+}
+
+type rejectionKey struct {
+	projectID string
+	reason    RejectionReason
+	detail    string
+}
+
+// Caps the number of distinct keys so that spamming random project IDs can't grow the map unbounded
+var maxRejectionKeys = 1000
+
+var rejections = make(map[rejectionKey]int)
+var rejectionsMutex sync.Mutex
+
+// Counts are kept in memory and reset on restart, they're meant to spot misconfigured snippets
+func recordRejection(projectID string, reason RejectionReason, detail string) {
+	rejectionsMutex.Lock()
+	defer rejectionsMutex.Unlock()
+
+	key := rejectionKey{projectID: projectID, reason: reason, detail: detail}
+
+	_, exists := rejections[key]
+	if !exists && len(rejections) >= maxRejectionKeys {
+		key = rejectionKey{reason: reason, detail: "Others"}
+	}
+
+	rejections[key]++
+}
+
+func GetRejections() []RejectionRecord {
+	rejectionsMutex.Lock()
+	defer rejectionsMutex.Unlock()
+
+	var records []RejectionRecord
+	for key, count := range rejections {
+		records = append(records, RejectionRecord{
+			ProjectID: key.projectID,
+			Reason:    key.reason,
+			Detail:    key.detail,
+			Count:     count,
+		})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Count > records[j].Count
+	})
+
+	return records
+}
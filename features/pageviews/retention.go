@@ -0,0 +1,117 @@
+package pageviews
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mouji/commons/config"
+	"mouji/commons/sqlite"
+	"mouji/features/projects"
+	"strconv"
+	"time"
+)
+
+var purgeBatchSize int64 = 1000
+var purgeBatchPause = 50 * time.Millisecond
+
+// Returns 0 when data should be kept forever
+func GetRetentionMonths() int {
+	value, err := config.GetConfig("retention_months")
+	if err != nil || value == "" {
+		return 0
+	}
+
+	months, err := strconv.Atoi(value)
+	if err != nil || months < 0 {
+		slog.Error("invalid retention in config, keeping data forever", "value", value)
+		return 0
+	}
+
+	return months
+}
+
+func ShouldRollupPurgedPageViews() bool {
+	value, err := config.GetConfig("should_rollup_purged_pageviews")
+	return err == nil && value == "true"
+}
+
+// Runs daily from the background tasks, the project's retention overrides the global one.
+// Raw pageviews are never purged before they're rolled up, the rollups are kept for the charts unless turned off in Settings
+func PurgeExpiredData(ctx context.Context) {
+	defaultRetentionMonths := GetRetentionMonths()
+	shouldRollup := ShouldRollupPurgedPageViews()
+
+	allProjects, err := projects.ListProjects()
+	if err != nil {
+		return
+	}
+
+	for _, project := range allProjects {
+		if ctx.Err() != nil {
+			return
+		}
+
+		retentionMonths := defaultRetentionMonths
+		if project.RetentionMonths > 0 {
+			retentionMonths = project.RetentionMonths
+		}
+		if retentionMonths == 0 {
+			continue
+		}
+
+		cutoff := time.Now().UTC().AddDate(0, -retentionMonths, 0).Format("2006-01-02")
+		if rolledUpUntil := getRolledUpUntil(); rolledUpUntil < cutoff {
+			cutoff = rolledUpUntil
+		}
+
+		if !shouldRollup {
+			err := deleteRollups(project.ProjectID, cutoff)
+			if err != nil {
+				continue
+			}
+		}
+
+		purgedPageViews, err := deleteInBatches(ctx, "pageviews", project.ProjectID, cutoff)
+		if err != nil {
+			continue
+		}
+
+		purgedEvents, err := deleteInBatches(ctx, "events", project.ProjectID, cutoff)
+		if err != nil {
+			continue
+		}
+
+		slog.Info("purged expired data", "project_id", project.ProjectID, "cutoff", cutoff, "pageviews", purgedPageViews, "events", purgedEvents)
+	}
+}
+
+// Deleting everything in one statement would hold the write lock for long and block the collect endpoint,
+// so rows are deleted in small batches with a pause in between to let the inserts through.
+// Both values of is_bot are listed so that the pageviews index, which has is_bot before received_at, is searched by received_at
+func deleteInBatches(ctx context.Context, table string, projectID string, cutoff string) (int64, error) {
+	var total int64
+	query := fmt.Sprintf("DELETE FROM %s WHERE rowid IN (SELECT rowid FROM %s WHERE project_id = ? AND is_bot IN (0, 1) AND received_at < ? LIMIT ?)", table, table)
+
+	for {
+		result, err := sqlite.DB.Exec(query, projectID, cutoff, purgeBatchSize)
+		if err != nil {
+			err = fmt.Errorf("error purging %s: %w", table, err)
+			slog.Error(err.Error())
+			return total, err
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			err = fmt.Errorf("error purging %s: %w", table, err)
+			slog.Error(err.Error())
+			return total, err
+		}
+
+		total += deleted
+		if deleted < purgeBatchSize || ctx.Err() != nil {
+			return total, nil
+		}
+
+		time.Sleep(purgeBatchPause)
+	}
+}
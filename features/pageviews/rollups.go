@@ -0,0 +1,457 @@
+package pageviews
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mouji/commons/config"
+	"mouji/commons/sqlite"
+	"mouji/features/projects"
+	"time"
+)
+
+var rollupHourFormat = "2006-01-02 15:00:00"
+var rollupChunkSize = 24 * time.Hour
+var rollupChunkPause = 50 * time.Millisecond
+
+// Pageviews are timestamped when queued and written a flush later, so an hour is rolled up only after its writes have landed
+var rollupDelay = time.Minute
+
+// Visitor hashes rotate daily, so apart from the distinct visitors of the hour, a visitor is counted under new_visitors
+// in the hour of their first hit of the day. Summing new_visitors over hours gives the distinct visitors of days and months.
+// The same queries compute the rollups and the raw rows of the current hour so that both are counted the same way.
+// Params: project_id, from, to, from
+var hourlyCountsQuery = getHourlyCountsQuery("")
+
+// The condition is added to the pageviews the counts are computed from, see getFilterCondition.
+// Params: project_id, from, to, condition params, from
+func getHourlyCountsQuery(condition string) string {
+	return `
+	WITH hits AS (
+		SELECT
+			received_at,
+			visitor_hash,
+			MIN(received_at) OVER (PARTITION BY DATE(received_at), visitor_hash) AS first_seen_at
+		FROM
+			pageviews
+		WHERE
+			project_id = ?
+			AND
+			received_at >= DATE(?)
+			AND
+			received_at < ?
+			AND
+			is_bot = 0` + condition + `
+	)
+	SELECT
+		STRFTIME('%Y-%m-%d %H:00:00', received_at) AS hour,
+		COUNT(*) AS views,
+		COUNT(DISTINCT visitor_hash) AS visitors,
+		COUNT(DISTINCT CASE WHEN received_at = first_seen_at THEN visitor_hash END) AS new_visitors
+	FROM
+		hits
+	WHERE
+		received_at >= ?
+	GROUP BY
+		hour
+`
+}
+
+// Params: project_id, from, to, from
+var hourlyPathCountsQuery = getHourlyPathCountsQuery("")
+
+// Params: project_id, from, to, condition params, from
+func getHourlyPathCountsQuery(condition string) string {
+	return `
+	WITH hits AS (
+		SELECT
+			received_at,
+			path,
+			title,
+			visitor_hash,
+			MIN(received_at) OVER (PARTITION BY DATE(received_at), path, visitor_hash) AS first_seen_at
+		FROM
+			pageviews
+		WHERE
+			project_id = ?
+			AND
+			received_at >= DATE(?)
+			AND
+			received_at < ?
+			AND
+			is_bot = 0` + condition + `
+	)
+	SELECT
+		STRFTIME('%Y-%m-%d %H:00:00', received_at) AS hour,
+		path,
+		MAX(title) AS title,
+		COUNT(*) AS views,
+		COUNT(DISTINCT CASE WHEN received_at = first_seen_at THEN visitor_hash END) AS new_visitors
+	FROM
+		hits
+	WHERE
+		received_at >= ?
+	GROUP BY
+		hour,
+		path
+`
+}
+
+// Params: project_id, from, to
+var hourlyReferrerCountsQuery = getHourlyReferrerCountsQuery("")
+
+// Params: project_id, from, to, condition params
+func getHourlyReferrerCountsQuery(condition string) string {
+	return `
+	SELECT
+		STRFTIME('%Y-%m-%d %H:00:00', received_at) AS hour,
+		referrer,
+		COUNT(*) AS views
+	FROM
+		pageviews
+	WHERE
+		project_id = ?
+		AND
+		received_at >= ?
+		AND
+		received_at < ?
+		AND
+		is_bot = 0` + condition + `
+	GROUP BY
+		hour,
+		referrer
+`
+}
+
+// Pageviews recorded before the user agent was classified are grouped under "Unknown".
+// Params: project_id, from, to, from
+func getHourlyBreakdownCountsQuery(dimension BreakdownDimension) string {
+	return `
+	WITH hits AS (
+		SELECT
+			received_at,
+			COALESCE(` + string(dimension) + `, 'Unknown') AS name,
+			visitor_hash,
+			MIN(received_at) OVER (PARTITION BY DATE(received_at), COALESCE(` + string(dimension) + `, 'Unknown'), visitor_hash) AS first_seen_at
+		FROM
+			pageviews
+		WHERE
+			project_id = ?
+			AND
+			received_at >= DATE(?)
+			AND
+			received_at < ?
+			AND
+			is_bot = 0
+	)
+	SELECT
+		STRFTIME('%Y-%m-%d %H:00:00', received_at) AS hour,
+		name,
+		COUNT(*) AS views,
+		COUNT(DISTINCT CASE WHEN received_at = first_seen_at THEN visitor_hash END) AS new_visitors
+	FROM
+		hits
+	WHERE
+		received_at >= ?
+	GROUP BY
+		hour,
+		name
+`
+}
+
+// Hours before this are in the rollup tables, empty if nothing has been rolled up yet
+func getRolledUpUntil() string {
+	rolledUpUntil, err := config.GetConfig("rolled_up_until")
+	if err != nil {
+		return ""
+	}
+
+	return rolledUpUntil
+}
+
+// Rollups of the completed hours followed by the raw rows of the hours that are not rolled up yet.
+// Params: see getRollupArgs
+var hourlyRollupsQuery = `
+	SELECT
+		hour,
+		views,
+		visitors,
+		new_visitors
+	FROM
+		pageview_hourly_rollups
+	WHERE
+		project_id = ?
+		AND
+		hour >= ?
+		AND
+		hour < ?
+	UNION ALL
+	SELECT
+		hour,
+		views,
+		visitors,
+		new_visitors
+	FROM
+		(` + hourlyCountsQuery + `)
+`
+
+// Params: see getRollupArgs
+var hourlyPathRollupsQuery = `
+	SELECT
+		path,
+		title,
+		views,
+		new_visitors
+	FROM
+		pageview_hourly_path_rollups
+	WHERE
+		project_id = ?
+		AND
+		hour >= ?
+		AND
+		hour < ?
+	UNION ALL
+	SELECT
+		path,
+		title,
+		views,
+		new_visitors
+	FROM
+		(` + hourlyPathCountsQuery + `)
+`
+
+// Params: see getRollupArgs, without the last one
+var hourlyReferrerRollupsQuery = `
+	SELECT
+		referrer,
+		views
+	FROM
+		pageview_hourly_referrer_rollups
+	WHERE
+		project_id = ?
+		AND
+		hour >= ?
+		AND
+		hour < ?
+	UNION ALL
+	SELECT
+		referrer,
+		views
+	FROM
+		(` + hourlyReferrerCountsQuery + `)
+`
+
+// Params: project_id, dimension, then see getRollupArgs
+func getHourlyBreakdownRollupsQuery(dimension BreakdownDimension) string {
+	return `
+	SELECT
+		name,
+		views,
+		new_visitors
+	FROM
+		pageview_hourly_breakdown_rollups
+	WHERE
+		project_id = ?
+		AND
+		dimension = ?
+		AND
+		hour >= ?
+		AND
+		hour < ?
+	UNION ALL
+	SELECT
+		name,
+		views,
+		new_visitors
+	FROM
+		(` + getHourlyBreakdownCountsQuery(dimension) + `)
+`
+}
+
+// The rollups are read from the start of the time range and the raw rows from wherever the rollups end
+func getRollupArgs(projectID string, timeRange TimeRange) []any {
+	from := formatTime(timeRange.From)
+	to := formatTime(timeRange.To)
+
+	rolledUpUntil := getRolledUpUntil()
+	if rolledUpUntil < from {
+		rolledUpUntil = from
+	}
+	if rolledUpUntil > to {
+		rolledUpUntil = to
+	}
+
+	return []any{projectID, from, rolledUpUntil, projectID, rolledUpUntil, to, rolledUpUntil}
+}
+
+// Rollups only have totals, so filtered counts are computed from the raw rows of the whole time range.
+// Returns the query for a CTE with the columns of hourlyRollupsQuery and its args
+func getHourlyCounts(projectID string, timeRange TimeRange, filters Filters) (string, []any) {
+	if filters.IsEmpty() {
+		return hourlyRollupsQuery, getRollupArgs(projectID, timeRange)
+	}
+
+	from := formatTime(timeRange.From)
+	condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+	args := append([]any{projectID, from, formatTime(timeRange.To)}, conditionArgs...)
+	return getHourlyCountsQuery(condition), append(args, from)
+}
+
+// Same as getHourlyCounts, with the columns of hourlyPathRollupsQuery
+func getHourlyPathCounts(projectID string, timeRange TimeRange, filters Filters) (string, []any) {
+	if filters.IsEmpty() {
+		return hourlyPathRollupsQuery, getRollupArgs(projectID, timeRange)
+	}
+
+	from := formatTime(timeRange.From)
+	condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+	args := append([]any{projectID, from, formatTime(timeRange.To)}, conditionArgs...)
+	return getHourlyPathCountsQuery(condition), append(args, from)
+}
+
+// Same as getHourlyCounts, with the columns of hourlyReferrerRollupsQuery
+func getHourlyReferrerCounts(projectID string, timeRange TimeRange, filters Filters) (string, []any) {
+	if filters.IsEmpty() {
+		return hourlyReferrerRollupsQuery, getRollupArgs(projectID, timeRange)[:6]
+	}
+
+	condition, conditionArgs := getFilterCondition(projectID, timeRange, filters)
+
+	args := []any{projectID, formatTime(timeRange.From), formatTime(timeRange.To)}
+	return getHourlyReferrerCountsQuery(condition), append(args, conditionArgs...)
+}
+
+// Same as getHourlyCounts, with the columns of getHourlyBreakdownRollupsQuery. Filtered breakdowns are counted in GetBreakdown
+func getHourlyBreakdownCounts(projectID string, timeRange TimeRange, dimension BreakdownDimension) (string, []any) {
+	args := getRollupArgs(projectID, timeRange)
+	args = append([]any{args[0], string(dimension)}, args[1:]...)
+
+	return getHourlyBreakdownRollupsQuery(dimension), args
+}
+
+// Runs every minute from the background tasks and rolls up the hours completed since the last run.
+// The first run on an existing database goes through the history a day at a time to avoid holding the write lock for long,
+// cancelling the context stops it between days and the next run picks up from there
+func RollupPageViews(ctx context.Context) {
+	rolledUpUntil := getRolledUpUntil()
+	if rolledUpUntil == "" {
+		var err error
+		rolledUpUntil, err = getFirstPageViewHour()
+		if err != nil {
+			return
+		}
+	}
+
+	from, err := time.Parse(time.DateTime, rolledUpUntil)
+	if err != nil {
+		slog.Error("invalid rolled_up_until in config", "value", rolledUpUntil)
+		return
+	}
+
+	until := time.Now().UTC().Add(-rollupDelay).Truncate(time.Hour)
+
+	for from.Before(until) && ctx.Err() == nil {
+		to := from.Add(rollupChunkSize)
+		if to.After(until) {
+			to = until
+		}
+
+		err = rollupHours(from.Format(rollupHourFormat), to.Format(rollupHourFormat))
+		if err != nil {
+			return
+		}
+
+		from = to
+		time.Sleep(rollupChunkPause)
+	}
+}
+
+func getFirstPageViewHour() (string, error) {
+	hour := ""
+
+	query := "SELECT COALESCE(MIN(STRFTIME('%Y-%m-%d %H:00:00', received_at)), STRFTIME('%Y-%m-%d %H:00:00', 'now')) FROM pageviews"
+
+	row := sqlite.DB.QueryRow(query)
+	err := row.Scan(&hour)
+	if err != nil {
+		err = fmt.Errorf("error retrieving first pageview: %w", err)
+		slog.Error(err.Error())
+		return hour, err
+	}
+
+	return hour, nil
+}
+
+// The rollups and the new rolled_up_until are written in the same transaction so that readers see either the rollups or the raw rows
+func rollupHours(from string, to string) error {
+	allProjects, err := projects.ListProjects()
+	if err != nil {
+		return err
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		err = fmt.Errorf("error starting rollup transaction: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	countsQuery := "INSERT OR REPLACE INTO pageview_hourly_rollups (project_id, hour, views, visitors, new_visitors) SELECT ?, hour, views, visitors, new_visitors FROM (" + hourlyCountsQuery + ")"
+	pathCountsQuery := "INSERT OR REPLACE INTO pageview_hourly_path_rollups (project_id, hour, path, title, views, new_visitors) SELECT ?, hour, path, title, views, new_visitors FROM (" + hourlyPathCountsQuery + ")"
+	referrerCountsQuery := "INSERT OR REPLACE INTO pageview_hourly_referrer_rollups (project_id, hour, referrer, views) SELECT ?, hour, referrer, views FROM (" + hourlyReferrerCountsQuery + ")"
+	breakdownCountsQuery := "INSERT OR REPLACE INTO pageview_hourly_breakdown_rollups (project_id, hour, dimension, name, views, new_visitors) SELECT ?, hour, ?, name, views, new_visitors FROM (%s)"
+
+	for _, project := range allProjects {
+		_, err = tx.Exec(countsQuery, project.ProjectID, project.ProjectID, from, to, from)
+		if err == nil {
+			_, err = tx.Exec(pathCountsQuery, project.ProjectID, project.ProjectID, from, to, from)
+		}
+		if err == nil {
+			_, err = tx.Exec(referrerCountsQuery, project.ProjectID, project.ProjectID, from, to)
+		}
+		for _, dimension := range breakdownDimensions {
+			if err == nil {
+				_, err = tx.Exec(fmt.Sprintf(breakdownCountsQuery, getHourlyBreakdownCountsQuery(dimension)), project.ProjectID, string(dimension), project.ProjectID, from, to, from)
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("error rolling up pageviews: %w", err)
+			slog.Error(err.Error())
+			return err
+		}
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO config (key, value) VALUES ('rolled_up_until', ?)", to)
+	if err != nil {
+		err = fmt.Errorf("error updating rolled_up_until: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = fmt.Errorf("error committing rollups: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Used by the retention purge when the rollups of the purged days shouldn't be kept either
+func deleteRollups(projectID string, cutoff string) error {
+	for _, table := range []string{"pageview_hourly_rollups", "pageview_hourly_path_rollups", "pageview_hourly_referrer_rollups", "pageview_hourly_breakdown_rollups"} {
+		query := fmt.Sprintf("DELETE FROM %s WHERE project_id = ? AND hour < ?", table)
+		_, err := sqlite.DB.Exec(query, projectID, cutoff)
+		if err != nil {
+			err = fmt.Errorf("error purging %s: %w", table, err)
+			slog.Error(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
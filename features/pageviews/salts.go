@@ -0,0 +1,91 @@
+package pageviews
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"mouji/commons/sqlite"
+	"sync"
+	"time"
+)
+
+var saltDayFormat = "2006-01-02"
+
+type dailySalt struct {
+	day  string
+	salt string
+}
+
+var saltCache = make(map[string]dailySalt)
+var saltCacheMutex sync.Mutex
+
+// Each project gets a random salt per UTC day. Once the day is over the salt is deleted,
+// which makes the visitor hashes of that day impossible to link to later days or to brute force
+func getDailySalt(projectID string) (string, error) {
+	today := time.Now().UTC().Format(saltDayFormat)
+
+	saltCacheMutex.Lock()
+	defer saltCacheMutex.Unlock()
+
+	cached, exists := saltCache[projectID]
+	if exists && cached.day == today {
+		return cached.salt, nil
+	}
+
+	salt, err := getOrInsertSalt(projectID, today)
+	if err != nil {
+		return "", err
+	}
+
+	saltCache[projectID] = dailySalt{day: today, salt: salt}
+	return salt, nil
+}
+
+func getOrInsertSalt(projectID string, day string) (string, error) {
+	bytes := make([]byte, 32)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		err = fmt.Errorf("error generating salt: %w", err)
+		slog.Error(err.Error())
+		return "", err
+	}
+
+	query := "INSERT OR IGNORE INTO salts (project_id, day, salt) VALUES (?, ?, ?)"
+	_, err = sqlite.DB.Exec(query, projectID, day, hex.EncodeToString(bytes))
+	if err != nil {
+		err = fmt.Errorf("error inserting salt: %w", err)
+		slog.Error(err.Error())
+		return "", err
+	}
+
+	var salt string
+	query = "SELECT salt FROM salts WHERE project_id = ? AND day = ?"
+	err = sqlite.DB.QueryRow(query, projectID, day).Scan(&salt)
+	if err != nil {
+		err = fmt.Errorf("error retrieving salt: %w", err)
+		slog.Error(err.Error())
+		return "", err
+	}
+
+	return salt, nil
+}
+
+// Runs at midnight UTC, new salts are created lazily on the first hit of the day
+func RotateSalts() {
+	today := time.Now().UTC().Format(saltDayFormat)
+
+	saltCacheMutex.Lock()
+	for projectID, cached := range saltCache {
+		if cached.day != today {
+			delete(saltCache, projectID)
+		}
+	}
+	saltCacheMutex.Unlock()
+
+	query := "DELETE FROM salts WHERE day < ?"
+	_, err := sqlite.DB.Exec(query, today)
+	if err != nil {
+		slog.Error("error deleting old salts", "error", err)
+	}
+}
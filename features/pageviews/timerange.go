@@ -0,0 +1,103 @@
+package pageviews
+
+import (
+	"time"
+)
+
+type Interval string
+
+const (
+	HourlyInterval  Interval = "hourly"
+	DailyInterval   Interval = "daily"
+	MonthlyInterval Interval = "monthly"
+)
+
+// Half-open interval [From, To) that the dashboard queries are bound to.
+// Location is the timezone that the chart buckets and their labels are in, nil means UTC.
+// From is expected at the start of an hour so that it lines up with the hourly rollups,
+// which in timezones with a half hour offset like Asia/Kolkata shifts the buckets by 30 minutes
+type TimeRange struct {
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// Boundaries are formatted like received_at so that the rollup hours can be compared against them
+type bucket struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Label string `json:"label"`
+}
+
+// Chart buckets are picked based on the span, so that a chart has somewhere between a dozen and a hundred bars
+func getInterval(timeRange TimeRange) Interval {
+	span := timeRange.To.Sub(timeRange.From)
+
+	switch {
+	case span <= 48*time.Hour:
+		return HourlyInterval
+	case span <= 93*24*time.Hour:
+		return DailyInterval
+	}
+
+	return MonthlyInterval
+}
+
+// Days and months start at midnight in the time range's location, so they're 23 or 25 hours long across DST transitions.
+// Hours are always 60 minutes, the transition shows up in the labels instead, like "01 AM EDT - 01 AM EST"
+func getBuckets(timeRange TimeRange) []bucket {
+	var buckets []bucket
+
+	location := timeRange.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	interval := getInterval(timeRange)
+
+	start := timeRange.From.In(location)
+	for start.Before(timeRange.To) {
+		var end time.Time
+		var label string
+
+		switch interval {
+		case HourlyInterval:
+			end = start.Add(time.Hour)
+			label = getHourLabel(start, end.In(location))
+		case DailyInterval:
+			end = time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, location)
+			label = start.Format("02 Jan")
+		default:
+			end = time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, location)
+			label = start.Format("2006 Jan")
+		}
+
+		if end.After(timeRange.To) {
+			end = timeRange.To.In(location)
+		}
+
+		buckets = append(buckets, bucket{Start: formatTime(start), End: formatTime(end), Label: label})
+		start = end
+	}
+
+	return buckets
+}
+
+// "05 Oct, 11 - 12 PM", with minutes in timezones with a half hour offset and with the zone on DST transitions
+func getHourLabel(start time.Time, end time.Time) string {
+	hourFormat := "03"
+	if start.Minute() != 0 {
+		hourFormat = "03:04"
+	}
+
+	if start.Format("MST") != end.Format("MST") {
+		return start.Format("02 Jan, "+hourFormat+" PM MST") + " - " + end.Format(hourFormat+" PM MST")
+	}
+
+	return start.Format("02 Jan, "+hourFormat) + " - " + end.Format(hourFormat+" PM")
+}
+
+// Same format as SQLite's CURRENT_TIMESTAMP which received_at is stored in
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.DateTime)
+}
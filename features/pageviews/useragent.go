@@ -0,0 +1,87 @@
+package pageviews
+
+import (
+	"strings"
+)
+
+type userAgentInfo struct {
+	Browser    string
+	OS         string
+	DeviceType string
+}
+
+// Classifies the User-Agent into broad families, the order of checks matters as most browsers
+// include the tokens of the browsers they are derived from, "Edg/" UAs also contain "Chrome/" and "Safari/"
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/User-Agent#browser_name_and_version
+func parseUserAgent(userAgent string) userAgentInfo {
+	return userAgentInfo{
+		Browser:    getBrowser(userAgent),
+		OS:         getOS(userAgent),
+		DeviceType: getDeviceType(userAgent),
+	}
+}
+
+func getBrowser(userAgent string) string {
+	switch {
+	case containsAny(userAgent, "Edg/", "EdgA/", "EdgiOS/"):
+		return "Edge"
+	case containsAny(userAgent, "OPR/", "Opera"):
+		return "Opera"
+	case containsAny(userAgent, "SamsungBrowser/"):
+		return "Samsung Internet"
+	case containsAny(userAgent, "Firefox/", "FxiOS/"):
+		return "Firefox"
+	case containsAny(userAgent, "Chrome/", "CriOS/", "Chromium/"):
+		return "Chrome"
+	case containsAny(userAgent, "Safari/"):
+		return "Safari"
+	case containsAny(userAgent, "MSIE ", "Trident/"):
+		return "Internet Explorer"
+	}
+
+	return "Other"
+}
+
+func getOS(userAgent string) string {
+	switch {
+	case containsAny(userAgent, "Windows"):
+		return "Windows"
+	case containsAny(userAgent, "iPhone", "iPad", "iPod"):
+		return "iOS"
+	case containsAny(userAgent, "Android"):
+		return "Android"
+	case containsAny(userAgent, "Macintosh", "Mac OS X"):
+		return "macOS"
+	case containsAny(userAgent, "CrOS"):
+		return "Chrome OS"
+	case containsAny(userAgent, "Linux"):
+		return "Linux"
+	}
+
+	return "Other"
+}
+
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Browser_detection_using_the_user_agent#mobile_tablet_or_desktop
+func getDeviceType(userAgent string) string {
+	switch {
+	case isBotUserAgent(userAgent):
+		return "Bot"
+	case containsAny(userAgent, "iPad", "Tablet"):
+		return "Tablet"
+	case containsAny(userAgent, "Android") && !containsAny(userAgent, "Mobile"):
+		return "Tablet"
+	case containsAny(userAgent, "Mobi", "iPhone", "iPod", "Android"):
+		return "Mobile"
+	}
+
+	return "Desktop"
+}
+
+func containsAny(userAgent string, tokens ...string) bool {
+	for _, token := range tokens {
+		if strings.Contains(userAgent, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package pageviews
+
+import (
+	"database/sql"
+	"errors"
+	"mouji/features/projects"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Rejects hits for unknown projects and, if the project opts in, hits from origins other than its own
+// Returns the project for the later checks and the status code to respond with along with the error
+func validateProject(r *http.Request, projectID string) (projects.ProjectRecord, int, error) {
+	project, err := projects.GetProjectByID(projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		recordRejection("", UnknownProjectRejection, projectID)
+		return project, http.StatusBadRequest, errors.New("unknown project_id")
+	}
+	if err != nil {
+		return project, http.StatusInternalServerError, err
+	}
+
+	if !project.ShouldVerifyOrigin {
+		return project, http.StatusOK, nil
+	}
+
+	hostname := getRequestOriginHostname(r)
+	if !slices.Contains(getAllowedHostnames(project), hostname) {
+		recordRejection(projectID, OriginMismatchRejection, hostname)
+		return project, http.StatusForbidden, errors.New("origin not allowed")
+	}
+
+	return project, http.StatusOK, nil
+}
+
+// Browsers send Origin for cross-origin XHR and beacons, Referer is the fallback for older browsers
+func getRequestOriginHostname(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = r.Header.Get("Referer")
+	}
+
+	return normalizeHostname(origin)
+}
+
+func getAllowedHostnames(project projects.ProjectRecord) []string {
+	hostnames := []string{normalizeHostname(project.BaseURL)}
+
+	for _, hostname := range strings.Split(project.AllowedHostnames, ",") {
+		hostname = strings.TrimSpace(hostname)
+		if hostname != "" {
+			hostnames = append(hostnames, normalizeHostname("https://"+hostname))
+		}
+	}
+
+	return hostnames
+}
+
+// "www.example.com" and "example.com" are treated as the same site
+func normalizeHostname(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	hostname := strings.ToLower(parsedURL.Hostname())
+	return strings.TrimPrefix(hostname, "www.")
+}
@@ -0,0 +1,136 @@
+package projects
+
+import (
+	"fmt"
+	"mouji/commons/components"
+	"mouji/commons/templates"
+	"net/http"
+	"strings"
+)
+
+func HandleNewGoalPage(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("project_id")
+
+	name := ""
+	goalType := PathGoalType
+	target := ""
+	nameError := ""
+	targetError := ""
+
+	renderGoalDetailPage(w, projectID, name, goalType, target, nameError, targetError)
+}
+
+func HandleNewGoalSubmit(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("project_id")
+
+	err := r.ParseForm()
+	if err != nil {
+		err = fmt.Errorf("error parsing form: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+	goalType := GoalType(r.Form.Get("goal_type"))
+	target := strings.TrimSpace(r.Form.Get("target"))
+	nameError := ""
+	targetError := ""
+
+	if goalType != PathGoalType && goalType != EventGoalType {
+		http.Error(w, "invalid goal type", http.StatusBadRequest)
+		return
+	}
+
+	if name == "" {
+		nameError = "Goal name should not be empty"
+	}
+
+	if goalType == PathGoalType && !strings.HasPrefix(target, "/") {
+		targetError = "Path should start with /"
+	}
+
+	if goalType == EventGoalType && target == "" {
+		targetError = "Event name should not be empty"
+	}
+
+	if nameError != "" || targetError != "" {
+		renderGoalDetailPage(w, projectID, name, goalType, target, nameError, targetError)
+		return
+	}
+
+	err = insertGoal(projectID, name, goalType, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	projectDetailURL := fmt.Sprintf("/projects/%s", projectID)
+	http.Redirect(w, r, projectDetailURL, http.StatusSeeOther)
+}
+
+func HandleDeleteGoalSubmit(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("project_id")
+	goalID := r.PathValue("goal_id")
+
+	err := deleteGoal(projectID, goalID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	projectDetailURL := fmt.Sprintf("/projects/%s", projectID)
+	http.Redirect(w, r, projectDetailURL, http.StatusSeeOther)
+}
+
+func renderGoalDetailPage(w http.ResponseWriter, projectID string, name string, goalType GoalType, target string, nameError string, targetError string) {
+	type templateData struct {
+		Navbar           components.Navbar
+		ProjectID        string
+		NameInput        components.Input
+		GoalTypeDropdown components.Dropdown
+		TargetInput      components.Input
+		SubmitButton     components.Button
+	}
+
+	pathOption := components.DropdownOption{Name: "Visited path", Value: string(PathGoalType)}
+	eventOption := components.DropdownOption{Name: "Fired event", Value: string(EventGoalType)}
+
+	selectedOption := pathOption
+	if goalType == EventGoalType {
+		selectedOption = eventOption
+	}
+
+	tmplData := templateData{
+		Navbar:    components.NewNavbar(false),
+		ProjectID: projectID,
+		NameInput: components.Input{
+			ID:          "name",
+			Label:       "Name",
+			Type:        "text",
+			Placeholder: "Example: Signups",
+			Error:       nameError,
+			Value:       name,
+		},
+		GoalTypeDropdown: components.Dropdown{
+			SelectedOption: selectedOption,
+			AllOptions:     []components.DropdownOption{pathOption, eventOption},
+			InputName:      "goal_type",
+		},
+		TargetInput: components.Input{
+			ID:          "target",
+			Label:       "Path or Event Name",
+			Type:        "text",
+			Placeholder: "Example: /thank-you",
+			Error:       targetError,
+			Value:       target,
+			Hint:        "Paths can use * as a wildcard, for example /docs/*",
+		},
+		SubmitButton: components.Button{
+			Text:      "Create",
+			IsSubmit:  true,
+			IsPrimary: true,
+		},
+	}
+
+	templates.Render(w, "goal_detail.html", tmplData)
+}
@@ -0,0 +1,76 @@
+package projects
+
+import (
+	"fmt"
+	"log/slog"
+	"mouji/commons/sqlite"
+)
+
+type GoalType string
+
+const (
+	PathGoalType  GoalType = "path"
+	EventGoalType GoalType = "event"
+)
+
+// Target is a GLOB pattern like "/thank-you" or "/docs/*" for path goals and the event name for event goals
+type GoalRecord struct {
+	GoalID    string
+	ProjectID string
+	Name      string
+	Type      GoalType
+	Target    string
+}
+
+func GetGoalsByProjectID(projectID string) ([]GoalRecord, error) {
+	var goals []GoalRecord
+
+	query := "SELECT goal_id, project_id, name, goal_type, target FROM goals WHERE project_id = ? ORDER BY created_at ASC"
+
+	rows, err := sqlite.DB.Query(query, projectID)
+	if err != nil {
+		err = fmt.Errorf("error retrieving goals: %w", err)
+		slog.Error(err.Error())
+		return goals, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var goal GoalRecord
+		err = rows.Scan(&goal.GoalID, &goal.ProjectID, &goal.Name, &goal.Type, &goal.Target)
+		if err != nil {
+			err = fmt.Errorf("error retrieving goals: %w", err)
+			slog.Error(err.Error())
+			return goals, err
+		}
+		goals = append(goals, goal)
+	}
+
+	return goals, nil
+}
+
+func insertGoal(projectID string, name string, goalType GoalType, target string) error {
+	query := "INSERT INTO goals (project_id, name, goal_type, target) VALUES (?, ?, ?, ?)"
+
+	_, err := sqlite.DB.Exec(query, projectID, name, goalType, target)
+	if err != nil {
+		err = fmt.Errorf("error inserting goal: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func deleteGoal(projectID string, goalID string) error {
+	query := "DELETE FROM goals WHERE project_id = ? AND goal_id = ?"
+
+	_, err := sqlite.DB.Exec(query, projectID, goalID)
+	if err != nil {
+		err = fmt.Errorf("error deleting goal: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
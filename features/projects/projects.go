@@ -5,8 +5,10 @@ import (
 	"mouji/commons/components"
 	"mouji/commons/config"
 	"mouji/commons/templates"
+	"mouji/commons/timezones"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -14,11 +16,12 @@ func HandleNewProjectPage(w http.ResponseWriter, r *http.Request) {
 	isOnboarding := r.URL.Query().Get("is_onboarding") == "true"
 	isNewProject := true
 
-	projectID := ""
-	projectName := ""
-	siteBaseURL := ""
+	project := ProjectRecord{}
 	projectNameError := ""
 	siteBaseURLError := ""
+	allowedHostnamesError := ""
+	retentionMonthsError := ""
+	timezoneError := ""
 
 	serverURL, err := config.GetConfig("server_url")
 	if err != nil {
@@ -26,7 +29,9 @@ func HandleNewProjectPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	renderProjectDetailPage(w, isOnboarding, isNewProject, projectID, projectName, siteBaseURL, serverURL, projectNameError, siteBaseURLError)
+	goals := []GoalRecord{}
+
+	renderProjectDetailPage(w, isOnboarding, isNewProject, project, serverURL, goals, projectNameError, siteBaseURLError, allowedHostnamesError, retentionMonthsError, timezoneError)
 }
 
 func HandleEditProjectPage(w http.ResponseWriter, r *http.Request) {
@@ -34,7 +39,7 @@ func HandleEditProjectPage(w http.ResponseWriter, r *http.Request) {
 	isNewProject := false
 
 	projectID := r.PathValue("project_id")
-	project, err := getProjectByID(projectID)
+	project, err := GetProjectByID(projectID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -46,10 +51,19 @@ func HandleEditProjectPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	goals, err := GetGoalsByProjectID(projectID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	projectNameError := ""
 	siteBaseURLError := ""
+	allowedHostnamesError := ""
+	retentionMonthsError := ""
+	timezoneError := ""
 
-	renderProjectDetailPage(w, isOnboarding, isNewProject, project.ProjectID, project.Name, project.BaseURL, serverURL, projectNameError, siteBaseURLError)
+	renderProjectDetailPage(w, isOnboarding, isNewProject, project, serverURL, goals, projectNameError, siteBaseURLError, allowedHostnamesError, retentionMonthsError, timezoneError)
 }
 
 func HandleProjectDetailSubmit(w http.ResponseWriter, r *http.Request) {
@@ -66,8 +80,16 @@ func HandleProjectDetailSubmit(w http.ResponseWriter, r *http.Request) {
 
 	projectName := r.Form.Get("name")
 	siteBaseURL := r.Form.Get("base_url")
+	allowedHostnames := normalizeHostnames(r.Form.Get("allowed_hostnames"))
+	shouldVerifyOrigin := r.Form.Get("should_verify_origin") == "true"
+	shouldRespectPrivacySignals := r.Form.Get("should_respect_privacy_signals") == "true"
+	retentionMonths := strings.TrimSpace(r.Form.Get("retention_months"))
+	timezone := strings.TrimSpace(r.Form.Get("timezone"))
 	projectNameError := ""
 	siteBaseURLError := ""
+	allowedHostnamesError := ""
+	retentionMonthsError := ""
+	timezoneError := ""
 
 	serverURL, err := config.GetConfig("server_url")
 	if err != nil {
@@ -83,8 +105,42 @@ func HandleProjectDetailSubmit(w http.ResponseWriter, r *http.Request) {
 		siteBaseURLError = "Please enter a valid URL"
 	}
 
-	if projectNameError != "" || siteBaseURLError != "" {
-		renderProjectDetailPage(w, isOnboarding, isNewProject, projectID, projectName, siteBaseURL, serverURL, projectNameError, siteBaseURLError)
+	if !isValidHostnames(allowedHostnames) {
+		allowedHostnamesError = "Please enter hostnames without the protocol or path, like blog.example.com"
+	}
+
+	if !isValidRetentionMonths(retentionMonths) {
+		retentionMonthsError = "Please enter a number greater than 0 or leave it empty"
+	}
+
+	if !isNewProject && !timezones.IsValid(timezone) {
+		timezoneError = "Please enter a timezone like Asia/Singapore or UTC"
+	}
+
+	retentionMonthsValue, _ := strconv.Atoi(retentionMonths) // Empty means 0, which uses the retention from Settings
+
+	if projectNameError != "" || siteBaseURLError != "" || allowedHostnamesError != "" || retentionMonthsError != "" || timezoneError != "" {
+		goals := []GoalRecord{}
+		if !isNewProject {
+			goals, err = GetGoalsByProjectID(projectID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		project := ProjectRecord{
+			ProjectID:                   projectID,
+			Name:                        projectName,
+			BaseURL:                     siteBaseURL,
+			AllowedHostnames:            allowedHostnames,
+			ShouldVerifyOrigin:          shouldVerifyOrigin,
+			ShouldRespectPrivacySignals: shouldRespectPrivacySignals,
+			RetentionMonths:             retentionMonthsValue,
+			Timezone:                    timezone,
+		}
+
+		renderProjectDetailPage(w, isOnboarding, isNewProject, project, serverURL, goals, projectNameError, siteBaseURLError, allowedHostnamesError, retentionMonthsError, timezoneError)
 		return
 	}
 
@@ -92,7 +148,7 @@ func HandleProjectDetailSubmit(w http.ResponseWriter, r *http.Request) {
 	if isNewProject {
 		project, err = InsertProject(projectName, siteBaseURL)
 	} else {
-		project, err = updateProject(projectID, projectName, siteBaseURL)
+		project, err = updateProject(projectID, projectName, siteBaseURL, allowedHostnames, shouldVerifyOrigin, shouldRespectPrivacySignals, retentionMonthsValue, timezone)
 	}
 
 	if err != nil {
@@ -109,37 +165,49 @@ func HandleProjectDetailSubmit(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, projectDetailURL, http.StatusSeeOther)
 }
 
-func renderProjectDetailPage(w http.ResponseWriter, isOnboarding bool, isNewProject bool, projectID string, projectName string, siteBaseURL string, serverURL string, projectNameError string, siteBaseURLError string) {
+func renderProjectDetailPage(w http.ResponseWriter, isOnboarding bool, isNewProject bool, project ProjectRecord, serverURL string, goals []GoalRecord, projectNameError string, siteBaseURLError string, allowedHostnamesError string, retentionMonthsError string, timezoneError string) {
 	type templateData struct {
-		Navbar               components.Navbar
-		IsOnboarding         bool
-		IsNewProject         bool
-		ProjectID            string
-		ProjectNameInput     components.Input
-		SiteURLInput         components.Input
-		TrackingSnippetInput components.TextArea
-		SubmitButton         components.Button
+		Navbar                 components.Navbar
+		IsOnboarding           bool
+		IsNewProject           bool
+		ProjectID              string
+		ProjectNameInput       components.Input
+		SiteURLInput           components.Input
+		AllowedHostnamesInput  components.Input
+		VerifyOriginCheckbox   components.Checkbox
+		PrivacySignalsCheckbox components.Checkbox
+		RetentionMonthsInput   components.Input
+		TimezoneInput          components.Input
+		TrackingSnippetInput   components.TextArea
+		SubmitButton           components.Button
+		Goals                  []GoalRecord
+		NewGoalButton          components.Button
+	}
+
+	retentionMonths := ""
+	if project.RetentionMonths > 0 {
+		retentionMonths = strconv.Itoa(project.RetentionMonths)
 	}
 
 	trackingSnippet := ""
 	submitButtonText := "Create"
 	if !isNewProject {
 		submitButtonText = "Update"
-		trackingSnippet = getTrackingSnippet(serverURL, projectID)
+		trackingSnippet = getTrackingSnippet(serverURL, project.ProjectID, project.ShouldRespectPrivacySignals)
 	}
 
 	tmplData := templateData{
 		Navbar:       components.NewNavbar(false),
 		IsOnboarding: isOnboarding,
 		IsNewProject: isNewProject,
-		ProjectID:    projectID,
+		ProjectID:    project.ProjectID,
 		ProjectNameInput: components.Input{
 			ID:          "name",
 			Label:       "Name",
 			Type:        "text",
 			Placeholder: "Enter your project name",
 			Error:       projectNameError,
-			Value:       projectName,
+			Value:       project.Name,
 		},
 		SiteURLInput: components.Input{
 			ID:          "base_url",
@@ -147,14 +215,53 @@ func renderProjectDetailPage(w http.ResponseWriter, isOnboarding bool, isNewProj
 			Type:        "url",
 			Placeholder: "Example: https://www.blogpost.com",
 			Error:       siteBaseURLError,
-			Value:       siteBaseURL,
+			Value:       project.BaseURL,
 			Hint:        "Enter the base URL of the site associated with this project",
 		},
+		AllowedHostnamesInput: components.Input{
+			ID:          "allowed_hostnames",
+			Label:       "Additional Hostnames",
+			Type:        "text",
+			Placeholder: "Example: blog.example.com, example.org",
+			Error:       allowedHostnamesError,
+			Value:       project.AllowedHostnames,
+			Hint:        "Comma separated hostnames that are allowed to send hits apart from the site URL's",
+		},
+		VerifyOriginCheckbox: components.Checkbox{
+			ID:        "should_verify_origin",
+			Label:     "Only accept hits from the site URL and additional hostnames",
+			Hint:      "Hits from other origins are rejected and counted in Settings",
+			IsChecked: project.ShouldVerifyOrigin,
+		},
+		PrivacySignalsCheckbox: components.Checkbox{
+			ID:        "should_respect_privacy_signals",
+			Label:     "Don't record visitors who opt out with Do Not Track or Global Privacy Control",
+			Hint:      "The tracking snippet skips sending hits for them, hits from older snippets are skipped by the server and counted in Settings",
+			IsChecked: project.ShouldRespectPrivacySignals,
+		},
+		RetentionMonthsInput: components.Input{
+			ID:          "retention_months",
+			Label:       "Data Retention (Months)",
+			Type:        "number",
+			Placeholder: "Same as Settings",
+			Error:       retentionMonthsError,
+			Value:       retentionMonths,
+			Hint:        "Pageviews and events older than this are deleted daily, leave empty to use the retention from Settings",
+		},
+		TimezoneInput: components.Input{
+			ID:          "timezone",
+			Label:       "Timezone",
+			Type:        "text",
+			Placeholder: "Example: Asia/Singapore",
+			Error:       timezoneError,
+			Value:       project.Timezone,
+			Hint:        "Charts and date ranges on the dashboard start and end at midnight in this timezone, users can override it in Settings",
+		},
 		TrackingSnippetInput: components.TextArea{
 			ID:         "tracking_snippet",
 			Label:      "Tracking Snippet",
 			Content:    trackingSnippet,
-			Hint:       "Copy paste this tracking snippet in your site's HTML file at the end of head tag",
+			Hint:       "Copy paste this tracking snippet in your site's HTML file at the end of head tag. Add data-spa=\"true\" for single page apps",
 			IsDisabled: true,
 		},
 		SubmitButton: components.Button{
@@ -162,6 +269,12 @@ func renderProjectDetailPage(w http.ResponseWriter, isOnboarding bool, isNewProj
 			IsSubmit:  true,
 			IsPrimary: true,
 		},
+		Goals: goals,
+		NewGoalButton: components.Button{
+			Text: "New Goal",
+			Icon: "plus",
+			Link: fmt.Sprintf("/projects/%s/goals/new", project.ProjectID),
+		},
 	}
 
 	templates.Render(w, "project_detail.html", tmplData)
@@ -176,42 +289,48 @@ func isValidURL(siteBaseURL string) bool {
 	return err == nil
 }
 
-func getTrackingSnippet(serverURL string, projectID string) string {
-	var snippet = `
-<!-- mouji snippet -->
-<script>
-	(function() {
-		var COLLECT_URL = "%s/collect";
-		var PROJECT_ID = "%s";
-		var GLOBAL_VAR_NAME = "__mouji__";
-
-		window[GLOBAL_VAR_NAME] = {};
-
-		window[GLOBAL_VAR_NAME].sendPageView = function() {
-			var path = location.pathname;
-			var title = document.title;
-			var referrer = document.referrer;
-
-			var url =
-				COLLECT_URL +
-				"?project_id=" +
-				PROJECT_ID +
-				"&title=" +
-				encodeURIComponent(title) +
-				"&path=" +
-				encodeURIComponent(path) +
-				"&referrer=" +
-				encodeURIComponent(referrer);
-
-			var xhr = new XMLHttpRequest();
-			xhr.open("GET", url);
-			xhr.send();
-		};
-
-		window[GLOBAL_VAR_NAME].sendPageView();
-	})();
-</script>
-`
-	snippet = strings.TrimSpace(snippet)
-	return fmt.Sprintf(snippet, serverURL, projectID)
+func isValidHostnames(hostnames string) bool {
+	if hostnames == "" {
+		return true
+	}
+
+	for _, hostname := range strings.Split(hostnames, ", ") {
+		parsedURL, err := url.Parse("https://" + hostname)
+		if err != nil || parsedURL.Host != hostname || parsedURL.Hostname() != hostname {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isValidRetentionMonths(retentionMonths string) bool {
+	if retentionMonths == "" {
+		return true
+	}
+
+	months, err := strconv.Atoi(retentionMonths)
+	return err == nil && months > 0
+}
+
+func normalizeHostnames(hostnames string) string {
+	var normalized []string
+
+	for _, hostname := range strings.Split(hostnames, ",") {
+		hostname = strings.ToLower(strings.TrimSpace(hostname))
+		if hostname != "" {
+			normalized = append(normalized, hostname)
+		}
+	}
+
+	return strings.Join(normalized, ", ")
+}
+
+// Projects that respect privacy signals have the tracker skip sending hits, so the visitor's IP and user agent don't reach the server
+func getTrackingSnippet(serverURL string, projectID string, shouldRespectPrivacySignals bool) string {
+	if shouldRespectPrivacySignals {
+		return fmt.Sprintf(`<script defer src="%s/script.js" data-project-id="%s" data-respect-privacy="true"></script>`, serverURL, projectID)
+	}
+
+	return fmt.Sprintf(`<script defer src="%s/script.js" data-project-id="%s"></script>`, serverURL, projectID)
 }
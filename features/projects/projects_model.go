@@ -9,9 +9,15 @@ import (
 )
 
 type ProjectRecord struct {
-	ProjectID string
-	Name      string
-	BaseURL   string
+	ProjectID          string
+	Name               string
+	BaseURL            string
+	AllowedHostnames   string // Comma separated hostnames that can send hits apart from the base URL's
+	ShouldVerifyOrigin bool
+	// Skip recording hits from browsers that send DNT or Sec-GPC
+	ShouldRespectPrivacySignals bool
+	RetentionMonths             int    // 0 uses the retention from Settings
+	Timezone                    string // IANA name like Asia/Singapore that the dashboard buckets and date ranges are in
 }
 
 func HasProjects() bool {
@@ -32,37 +38,52 @@ func HasProjects() bool {
 }
 
 func GetAllProjects() []ProjectRecord {
+	projects, err := ListProjects()
+	if err != nil {
+		panic(err)
+	}
+
+	return projects
+}
+
+// Same as GetAllProjects but returns the error, for background tasks where a panic would take down the server
+func ListProjects() ([]ProjectRecord, error) {
 	var projects []ProjectRecord
-	query := "SELECT project_id, name, base_url FROM projects ORDER BY created_at DESC"
+	query := "SELECT project_id, name, base_url, allowed_hostnames, should_verify_origin, should_respect_privacy_signals, retention_months, timezone FROM projects ORDER BY created_at DESC"
 
 	rows, err := sqlite.DB.Query(query)
-	defer rows.Close()
-
 	if err != nil {
 		err = fmt.Errorf("error retrieving projects: %w", err)
-		panic(err)
+		slog.Error(err.Error())
+		return projects, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var project ProjectRecord
-		err = rows.Scan(&project.ProjectID, &project.Name, &project.BaseURL)
+		err = rows.Scan(&project.ProjectID, &project.Name, &project.BaseURL, &project.AllowedHostnames, &project.ShouldVerifyOrigin, &project.ShouldRespectPrivacySignals, &project.RetentionMonths, &project.Timezone)
 		if err != nil {
 			err = fmt.Errorf("error retrieving projects: %w", err)
-			panic(err)
+			slog.Error(err.Error())
+			return projects, err
 		}
 		projects = append(projects, project)
 	}
 
-	return projects
+	return projects, nil
 }
 
-func getProjectByID(projectID string) (ProjectRecord, error) {
+// sql.ErrNoRows is returned as is without logging as the collect endpoint looks up untrusted project IDs
+func GetProjectByID(projectID string) (ProjectRecord, error) {
 	var project ProjectRecord
 
-	query := "SELECT project_id, name, base_url FROM projects where project_id = ?"
+	query := "SELECT project_id, name, base_url, allowed_hostnames, should_verify_origin, should_respect_privacy_signals, retention_months, timezone FROM projects where project_id = ?"
 
 	row := sqlite.DB.QueryRow(query, projectID)
-	err := row.Scan(&project.ProjectID, &project.Name, &project.BaseURL)
+	err := row.Scan(&project.ProjectID, &project.Name, &project.BaseURL, &project.AllowedHostnames, &project.ShouldVerifyOrigin, &project.ShouldRespectPrivacySignals, &project.RetentionMonths, &project.Timezone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return project, err
+	}
 	if err != nil {
 		err = fmt.Errorf("error retrieving project: %w", err)
 		slog.Error(err.Error())
@@ -89,10 +110,15 @@ func InsertProject(projectName string, serverBaseURL string) (ProjectRecord, err
 		RETURNING
 			project_id,
 			name,
-			base_url`
+			base_url,
+			allowed_hostnames,
+			should_verify_origin,
+			should_respect_privacy_signals,
+			retention_months,
+			timezone`
 
 	row := sqlite.DB.QueryRow(query, projectName, serverBaseURL)
-	err := row.Scan(&project.ProjectID, &project.Name, &project.BaseURL)
+	err := row.Scan(&project.ProjectID, &project.Name, &project.BaseURL, &project.AllowedHostnames, &project.ShouldVerifyOrigin, &project.ShouldRespectPrivacySignals, &project.RetentionMonths, &project.Timezone)
 	if err != nil {
 		err = fmt.Errorf("error inserting project: %w", err)
 		slog.Error(err.Error())
@@ -102,7 +128,7 @@ func InsertProject(projectName string, serverBaseURL string) (ProjectRecord, err
 	return project, nil
 }
 
-func updateProject(projectID string, projectName string, serverBaseURL string) (ProjectRecord, error) {
+func updateProject(projectID string, projectName string, serverBaseURL string, allowedHostnames string, shouldVerifyOrigin bool, shouldRespectPrivacySignals bool, retentionMonths int, timezone string) (ProjectRecord, error) {
 	var project ProjectRecord
 
 	query := `
@@ -110,17 +136,27 @@ func updateProject(projectID string, projectName string, serverBaseURL string) (
 		SET
 			name = ?,
 			base_url = ?,
+			allowed_hostnames = ?,
+			should_verify_origin = ?,
+			should_respect_privacy_signals = ?,
+			retention_months = ?,
+			timezone = ?,
 			updated_at = CURRENT_TIMESTAMP
 		WHERE
 			project_id = ?
 		RETURNING
 			project_id,
 			name,
-			base_url
+			base_url,
+			allowed_hostnames,
+			should_verify_origin,
+			should_respect_privacy_signals,
+			retention_months,
+			timezone
 	`
 
-	row := sqlite.DB.QueryRow(query, projectName, serverBaseURL, projectID)
-	err := row.Scan(&project.ProjectID, &project.Name, &project.BaseURL)
+	row := sqlite.DB.QueryRow(query, projectName, serverBaseURL, allowedHostnames, shouldVerifyOrigin, shouldRespectPrivacySignals, retentionMonths, timezone, projectID)
+	err := row.Scan(&project.ProjectID, &project.Name, &project.BaseURL, &project.AllowedHostnames, &project.ShouldVerifyOrigin, &project.ShouldRespectPrivacySignals, &project.RetentionMonths, &project.Timezone)
 	if err != nil {
 		err = fmt.Errorf("error updating project: %w", err)
 		slog.Error(err.Error())
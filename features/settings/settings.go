@@ -5,9 +5,12 @@ import (
 	"mouji/commons/components"
 	"mouji/commons/config"
 	"mouji/commons/templates"
+	"mouji/features/pageviews"
 	"mouji/features/projects"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 )
 
 func HandleSettingsPage(w http.ResponseWriter, r *http.Request) {
@@ -63,18 +66,187 @@ func HandleServerURLSubmit(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
+type rejectionsTableRecord struct {
+	ProjectName string
+	Reason      pageviews.RejectionReason
+	Detail      string
+	Count       int
+}
+
+func HandleRateLimitsPage(w http.ResponseWriter, r *http.Request) {
+	ipRateLimit := strconv.Itoa(pageviews.GetRateLimit("rate_limit_per_ip", pageviews.DefaultIPRateLimit))
+	projectRateLimit := strconv.Itoa(pageviews.GetRateLimit("rate_limit_per_project", pageviews.DefaultProjectRateLimit))
+	ipRateLimitError := ""
+	projectRateLimitError := ""
+
+	renderRateLimitsPage(w, ipRateLimit, projectRateLimit, ipRateLimitError, projectRateLimitError)
+}
+
+func HandleRateLimitsSubmit(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		err = fmt.Errorf("error parsing form: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ipRateLimit := r.Form.Get("rate_limit_per_ip")
+	projectRateLimit := r.Form.Get("rate_limit_per_project")
+	ipRateLimitError := ""
+	projectRateLimitError := ""
+
+	if !isValidRateLimit(ipRateLimit) {
+		ipRateLimitError = "Please enter a number greater than 0"
+	}
+
+	if !isValidRateLimit(projectRateLimit) {
+		projectRateLimitError = "Please enter a number greater than 0"
+	}
+
+	if ipRateLimitError != "" || projectRateLimitError != "" {
+		renderRateLimitsPage(w, ipRateLimit, projectRateLimit, ipRateLimitError, projectRateLimitError)
+		return
+	}
+
+	err = config.SetConfig("rate_limit_per_ip", ipRateLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = config.SetConfig("rate_limit_per_project", projectRateLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pageviews.LoadRateLimits()
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+func HandleTrustedProxiesPage(w http.ResponseWriter, r *http.Request) {
+	trustedProxies, err := config.GetConfig("trusted_proxies")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	trustedProxiesError := ""
+
+	renderTrustedProxiesPage(w, trustedProxies, trustedProxiesError)
+}
+
+func HandleTrustedProxiesSubmit(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		err = fmt.Errorf("error parsing form: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	trustedProxies := strings.TrimSpace(r.Form.Get("trusted_proxies"))
+	trustedProxiesError := ""
+
+	_, err = pageviews.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		trustedProxiesError = fmt.Sprintf("Please enter comma separated CIDRs or IP addresses, %s", err.Error())
+		renderTrustedProxiesPage(w, trustedProxies, trustedProxiesError)
+		return
+	}
+
+	err = config.SetConfig("trusted_proxies", trustedProxies)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pageviews.LoadTrustedProxies()
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+func HandleRetentionPage(w http.ResponseWriter, r *http.Request) {
+	retentionMonths := ""
+	if months := pageviews.GetRetentionMonths(); months > 0 {
+		retentionMonths = strconv.Itoa(months)
+	}
+	shouldRollup := pageviews.ShouldRollupPurgedPageViews()
+	retentionMonthsError := ""
+
+	renderRetentionPage(w, retentionMonths, shouldRollup, retentionMonthsError)
+}
+
+func HandleRetentionSubmit(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		err = fmt.Errorf("error parsing form: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	retentionMonths := strings.TrimSpace(r.Form.Get("retention_months"))
+	shouldRollup := r.Form.Get("should_rollup_purged_pageviews") == "true"
+	retentionMonthsError := ""
+
+	if retentionMonths != "" && !isValidRetentionMonths(retentionMonths) {
+		retentionMonthsError = "Please enter a number greater than 0 or leave it empty"
+		renderRetentionPage(w, retentionMonths, shouldRollup, retentionMonthsError)
+		return
+	}
+
+	err = config.SetConfig("retention_months", retentionMonths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = config.SetConfig("should_rollup_purged_pageviews", strconv.FormatBool(shouldRollup))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
 func renderSettingsPage(w http.ResponseWriter, allProjects []projects.ProjectRecord) {
 	type templateData struct {
 		Navbar               components.Navbar
 		Projects             []projects.ProjectRecord
+		Rejections           []rejectionsTableRecord
 		NewProjectButton     components.Button
 		ChangePasswordButton components.Button
+		TimezoneButton       components.Button
 		ServerURLButton      components.Button
+		RateLimitsButton     components.Button
+		TrustedProxiesButton components.Button
+		RetentionButton      components.Button
+	}
+
+	projectNames := make(map[string]string)
+	for _, project := range allProjects {
+		projectNames[project.ProjectID] = project.Name
+	}
+
+	var rejections []rejectionsTableRecord
+	for _, rejection := range pageviews.GetRejections() {
+		projectName, exists := projectNames[rejection.ProjectID]
+		if !exists {
+			projectName = "-"
+		}
+		rejections = append(rejections, rejectionsTableRecord{
+			ProjectName: projectName,
+			Reason:      rejection.Reason,
+			Detail:      rejection.Detail,
+			Count:       rejection.Count,
+		})
 	}
 
 	tmplData := templateData{
-		Navbar:   components.NewNavbar(false),
-		Projects: allProjects,
+		Navbar:     components.NewNavbar(false),
+		Projects:   allProjects,
+		Rejections: rejections,
 		NewProjectButton: components.Button{
 			Text: "New Project",
 			Icon: "plus",
@@ -85,11 +257,31 @@ func renderSettingsPage(w http.ResponseWriter, allProjects []projects.ProjectRec
 			Icon: "key",
 			Link: "/users/me/password",
 		},
+		TimezoneButton: components.Button{
+			Text: "Change Timezone",
+			Icon: "clock",
+			Link: "/users/me/timezone",
+		},
 		ServerURLButton: components.Button{
 			Text: "Change Server URL",
 			Icon: "server-stack",
 			Link: "/settings/server_url",
 		},
+		RateLimitsButton: components.Button{
+			Text: "Change Rate Limits",
+			Icon: "server-stack",
+			Link: "/settings/rate_limits",
+		},
+		TrustedProxiesButton: components.Button{
+			Text: "Change Trusted Proxies",
+			Icon: "server-stack",
+			Link: "/settings/trusted_proxies",
+		},
+		RetentionButton: components.Button{
+			Text: "Change Data Retention",
+			Icon: "server-stack",
+			Link: "/settings/retention",
+		},
 	}
 
 	templates.Render(w, "settings.html", tmplData)
@@ -125,6 +317,117 @@ func renderServerURLPage(w http.ResponseWriter, isOnboarding bool, serverURL str
 	templates.Render(w, "server_url.html", tmplData)
 }
 
+func renderRateLimitsPage(w http.ResponseWriter, ipRateLimit string, projectRateLimit string, ipRateLimitError string, projectRateLimitError string) {
+	type templateData struct {
+		Navbar                components.Navbar
+		IPRateLimitInput      components.Input
+		ProjectRateLimitInput components.Input
+		SubmitButton          components.Button
+	}
+
+	tmplData := templateData{
+		Navbar: components.NewNavbar(false),
+		IPRateLimitInput: components.Input{
+			ID:          "rate_limit_per_ip",
+			Label:       "Per IP",
+			Type:        "number",
+			Placeholder: strconv.Itoa(pageviews.DefaultIPRateLimit),
+			Error:       ipRateLimitError,
+			Value:       ipRateLimit,
+			Hint:        "Maximum hits per minute from a single IP address",
+		},
+		ProjectRateLimitInput: components.Input{
+			ID:          "rate_limit_per_project",
+			Label:       "Per Project",
+			Type:        "number",
+			Placeholder: strconv.Itoa(pageviews.DefaultProjectRateLimit),
+			Error:       projectRateLimitError,
+			Value:       projectRateLimit,
+			Hint:        "Maximum hits per minute for a single project across all visitors",
+		},
+		SubmitButton: components.Button{
+			Text:      "Update",
+			IsSubmit:  true,
+			IsPrimary: true,
+		},
+	}
+
+	templates.Render(w, "rate_limits.html", tmplData)
+}
+
+func renderTrustedProxiesPage(w http.ResponseWriter, trustedProxies string, trustedProxiesError string) {
+	type templateData struct {
+		Navbar              components.Navbar
+		TrustedProxiesInput components.Input
+		SubmitButton        components.Button
+	}
+
+	tmplData := templateData{
+		Navbar: components.NewNavbar(false),
+		TrustedProxiesInput: components.Input{
+			ID:          "trusted_proxies",
+			Label:       "Trusted Proxies",
+			Type:        "text",
+			Placeholder: "Example: 172.16.0.0/12, fdaa::/16",
+			Error:       trustedProxiesError,
+			Value:       trustedProxies,
+			Hint:        "Client IPs are read from Fly-Client-IP, X-Real-IP or X-Forwarded-For only for requests coming from these addresses. Until they're set, hits from private addresses aren't rate limited per IP",
+		},
+		SubmitButton: components.Button{
+			Text:      "Update",
+			IsSubmit:  true,
+			IsPrimary: true,
+		},
+	}
+
+	templates.Render(w, "trusted_proxies.html", tmplData)
+}
+
+func renderRetentionPage(w http.ResponseWriter, retentionMonths string, shouldRollup bool, retentionMonthsError string) {
+	type templateData struct {
+		Navbar               components.Navbar
+		RetentionMonthsInput components.Input
+		RollupCheckbox       components.Checkbox
+		SubmitButton         components.Button
+	}
+
+	tmplData := templateData{
+		Navbar: components.NewNavbar(false),
+		RetentionMonthsInput: components.Input{
+			ID:          "retention_months",
+			Label:       "Retention (Months)",
+			Type:        "number",
+			Placeholder: "Keep forever",
+			Error:       retentionMonthsError,
+			Value:       retentionMonths,
+			Hint:        "Pageviews and events older than this are deleted daily, projects can override it. Leave empty to keep them forever",
+		},
+		RollupCheckbox: components.Checkbox{
+			ID:        "should_rollup_purged_pageviews",
+			Label:     "Keep hourly totals of deleted pageviews",
+			Hint:      "Charts, top pages and top sources keep showing the deleted days, the breakdown tables don't",
+			IsChecked: shouldRollup,
+		},
+		SubmitButton: components.Button{
+			Text:      "Update",
+			IsSubmit:  true,
+			IsPrimary: true,
+		},
+	}
+
+	templates.Render(w, "retention.html", tmplData)
+}
+
+func isValidRetentionMonths(retentionMonths string) bool {
+	months, err := strconv.Atoi(retentionMonths)
+	return err == nil && months > 0
+}
+
+func isValidRateLimit(rateLimit string) bool {
+	limit, err := strconv.Atoi(rateLimit)
+	return err == nil && limit > 0
+}
+
 func isValidURL(serverURL string) bool {
 	_, err := url.ParseRequestURI(serverURL)
 	return err == nil
@@ -0,0 +1,61 @@
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Bump when the tracker's behaviour changes in a way that sites should know about
+var trackerVersion = "4"
+
+var script []byte = nil
+var etag = ""
+var loadedAt time.Time
+
+func NewTracker(resources embed.FS) {
+	content, err := fs.ReadFile(resources, "features/tracker/tracker.js")
+	if err != nil {
+		err = fmt.Errorf("error reading tracker script: %w", err)
+		panic(err)
+	}
+
+	script = minify(content)
+	script = append([]byte(fmt.Sprintf("/* mouji tracker v%s */\n", trackerVersion)), script...)
+
+	hash := sha256.Sum256(script)
+	etag = fmt.Sprintf(`"v%s-%x"`, trackerVersion, hash[:8])
+	loadedAt = time.Now()
+}
+
+// Browsers revalidate with the ETag once the cache expires, so tracker updates reach sites within a day
+func HandleTrackerScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400") // 1 day
+	w.Header().Set("ETag", etag)
+
+	http.ServeContent(w, r, "script.js", loadedAt, bytes.NewReader(script))
+}
+
+// Strips indentation, blank lines and full line comments. This relies on tracker.js
+// terminating every statement with a semicolon and not using trailing comments
+func minify(content []byte) []byte {
+	var lines []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
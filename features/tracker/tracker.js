@@ -0,0 +1,96 @@
+// mouji tracker
+// <script defer src="https://mouji.example.com/script.js" data-project-id="..."></script>
+// Add data-spa="true" to the script tag to track route changes in React, Vue and other single page apps
+// Add data-respect-privacy="true" to send nothing for visitors with Do Not Track or Global Privacy Control enabled
+(function() {
+	var script = document.currentScript;
+	if (!script) {
+		return;
+	}
+
+	var SERVER_URL = new URL(script.src).origin;
+	var COLLECT_URL = SERVER_URL + "/collect";
+	var EVENT_URL = SERVER_URL + "/collect/event";
+	var PROJECT_ID = script.getAttribute("data-project-id");
+	var IS_SPA = script.getAttribute("data-spa") === "true";
+	var SHOULD_RESPECT_PRIVACY = script.getAttribute("data-respect-privacy") === "true";
+	var GLOBAL_VAR_NAME = "__mouji__";
+	var DO_NOT_TRACK = navigator.doNotTrack === "1" || window.doNotTrack === "1";
+	var GLOBAL_PRIVACY_CONTROL = navigator.globalPrivacyControl === true;
+
+	window[GLOBAL_VAR_NAME] = {};
+
+	// sendBeacon survives page unloads and sends the string body as text/plain, which skips the CORS preflight
+	// Without data-respect-privacy the server decides whether to honour the privacy signals based on the project's setting
+	function send(url, payload) {
+		if (SHOULD_RESPECT_PRIVACY && (DO_NOT_TRACK || GLOBAL_PRIVACY_CONTROL)) {
+			return;
+		}
+
+		payload.dnt = DO_NOT_TRACK;
+		payload.gpc = GLOBAL_PRIVACY_CONTROL;
+		var body = JSON.stringify(payload);
+
+		if (navigator.sendBeacon && navigator.sendBeacon(url, body)) {
+			return;
+		}
+
+		var xhr = new XMLHttpRequest();
+		xhr.open("POST", url);
+		xhr.setRequestHeader("Content-Type", "text/plain");
+		xhr.send(body);
+	}
+
+	window[GLOBAL_VAR_NAME].sendPageView = function(previousURL) {
+		send(COLLECT_URL, {
+			project_id: PROJECT_ID,
+			title: document.title,
+			path: location.pathname,
+			referrer: previousURL || document.referrer
+		});
+	};
+
+	// Usage: __mouji__.track("signup", { plan: "pro" })
+	window[GLOBAL_VAR_NAME].track = function(name, props) {
+		send(EVENT_URL, {
+			project_id: PROJECT_ID,
+			name: name,
+			props: props || {},
+			path: location.pathname
+		});
+	};
+
+	window[GLOBAL_VAR_NAME].sendPageView();
+
+	if (IS_SPA) {
+		var lastPath = location.pathname;
+		var lastURL = location.href;
+		var timer = null;
+
+		// Wait for the router to update document.title and skip replaceState calls that don't change the path
+		// Route changes are referred by the previous route and not by document.referrer
+		function handleRouteChange() {
+			clearTimeout(timer);
+			timer = setTimeout(function() {
+				if (location.pathname === lastPath) {
+					return;
+				}
+				var previousURL = lastURL;
+				lastPath = location.pathname;
+				lastURL = location.href;
+				window[GLOBAL_VAR_NAME].sendPageView(previousURL);
+			}, 100);
+		}
+
+		["pushState", "replaceState"].forEach(function(method) {
+			var original = history[method];
+			history[method] = function() {
+				var result = original.apply(this, arguments);
+				handleRouteChange();
+				return result;
+			};
+		});
+
+		window.addEventListener("popstate", handleRouteChange);
+	}
+})();
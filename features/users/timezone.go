@@ -0,0 +1,98 @@
+package users
+
+import (
+	"fmt"
+	"mouji/commons/components"
+	"mouji/commons/session"
+	"mouji/commons/templates"
+	"mouji/commons/timezones"
+	"net/http"
+	"strings"
+)
+
+func HandleTimezonePage(w http.ResponseWriter, r *http.Request) {
+	user, err := GetSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	timezoneError := ""
+	renderTimezonePage(w, user.Timezone, timezoneError)
+}
+
+func HandleTimezoneSubmit(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		err = fmt.Errorf("error parsing form: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := GetSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	timezone := strings.TrimSpace(r.Form.Get("timezone"))
+	timezoneError := ""
+
+	// Empty falls back to the project's timezone
+	if timezone != "" && !timezones.IsValid(timezone) {
+		timezoneError = "Please enter a timezone like Asia/Singapore or leave it empty"
+		renderTimezonePage(w, timezone, timezoneError)
+		return
+	}
+
+	err = UpdateTimezone(user.UserID, timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// The user of the request's session, sql.ErrNoRows or http.ErrNoCookie if there isn't one
+func GetSessionUser(r *http.Request) (UserRecord, error) {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return UserRecord{}, err
+	}
+
+	userID, err := session.GetUserID(cookie.Value)
+	if err != nil {
+		return UserRecord{}, err
+	}
+
+	return GetUserByID(userID)
+}
+
+func renderTimezonePage(w http.ResponseWriter, timezone string, timezoneError string) {
+	type templateData struct {
+		Navbar        components.Navbar
+		TimezoneInput components.Input
+		SubmitButton  components.Button
+	}
+
+	tmplData := templateData{
+		Navbar: components.NewNavbar(false),
+		TimezoneInput: components.Input{
+			ID:          "timezone",
+			Label:       "Timezone",
+			Type:        "text",
+			Placeholder: "Same as the project",
+			Error:       timezoneError,
+			Value:       timezone,
+			Hint:        "Name from the IANA time zone database like Asia/Singapore, leave empty to use each project's timezone",
+		},
+		SubmitButton: components.Button{
+			Text:      "Update",
+			IsSubmit:  true,
+			IsPrimary: true,
+		},
+	}
+
+	templates.Render(w, "timezone.html", tmplData)
+}
@@ -12,6 +12,7 @@ type UserRecord struct {
 	UserID   string
 	Email    string
 	Password string
+	Timezone string // Overrides the project's timezone on the dashboard, empty uses the project's
 }
 
 func HasUsers() bool {
@@ -34,10 +35,10 @@ func HasUsers() bool {
 func GetUserByEmail(email string) (UserRecord, error) {
 	var user UserRecord
 
-	query := "SELECT user_id, email, password_hash FROM users where email = ?"
+	query := "SELECT user_id, email, password_hash, timezone FROM users where email = ?"
 
 	row := sqlite.DB.QueryRow(query, email)
-	err := row.Scan(&user.UserID, &user.Email, &user.Password)
+	err := row.Scan(&user.UserID, &user.Email, &user.Password, &user.Timezone)
 	if err != nil {
 		err = fmt.Errorf("error retrieving user: %w", err)
 		slog.Error(err.Error())
@@ -50,10 +51,10 @@ func GetUserByEmail(email string) (UserRecord, error) {
 func GetUserByID(userID string) (UserRecord, error) {
 	var user UserRecord
 
-	query := "SELECT user_id, email, password_hash FROM users where user_id = ?"
+	query := "SELECT user_id, email, password_hash, timezone FROM users where user_id = ?"
 
 	row := sqlite.DB.QueryRow(query, userID)
-	err := row.Scan(&user.UserID, &user.Email, &user.Password)
+	err := row.Scan(&user.UserID, &user.Email, &user.Password, &user.Timezone)
 	if err != nil {
 		err = fmt.Errorf("error retrieving user: %w", err)
 		slog.Error(err.Error())
@@ -66,10 +67,10 @@ func GetUserByID(userID string) (UserRecord, error) {
 func InsertUser(email string, passwordHash string, isAdmin bool) (UserRecord, error) {
 	var user UserRecord
 
-	query := "INSERT INTO users (email, password_hash, is_admin) VALUES (?, ?, ?) RETURNING user_id, email, password_hash"
+	query := "INSERT INTO users (email, password_hash, is_admin) VALUES (?, ?, ?) RETURNING user_id, email, password_hash, timezone"
 
 	row := sqlite.DB.QueryRow(query, email, passwordHash, isAdmin)
-	err := row.Scan(&user.UserID, &user.Email, &user.Password)
+	err := row.Scan(&user.UserID, &user.Email, &user.Password, &user.Timezone)
 
 	if err != nil {
 		err = fmt.Errorf("error inserting user: %w", err)
@@ -92,3 +93,16 @@ func UpdatePassword(userID, passwordHash string) error {
 
 	return nil
 }
+
+func UpdateTimezone(userID, timezone string) error {
+	query := "UPDATE users SET timezone = ? WHERE user_id = ?"
+
+	_, err := sqlite.DB.Exec(query, timezone, userID)
+	if err != nil {
+		err = fmt.Errorf("error updating timezone: %w", err)
+		slog.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
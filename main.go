@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"log/slog"
 	"mouji/commons/auth"
@@ -8,17 +9,27 @@ import (
 	"mouji/commons/sqlite"
 	"mouji/commons/templates"
 	"mouji/features/home"
+	"mouji/features/live"
 	"mouji/features/login"
 	"mouji/features/pageviews"
 	"mouji/features/projects"
 	"mouji/features/settings"
+	"mouji/features/tracker"
 	"mouji/features/users"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	// The slim runtime image has no zoneinfo, so the timezone database is compiled in for project and user timezones
+	_ "time/tzdata"
 )
 
+var shutdownTimeout = 10 * time.Second
+
 //go:embed all:commons all:features
 var resources embed.FS
 
@@ -37,13 +48,32 @@ func main() {
 	}()
 
 	sqlite.NewDB()
-	defer sqlite.DB.Close()
 
 	sqlite.Migrate(migrations)
 
 	templates.NewTemplates(resources)
 
-	go runBackgroundTasks()
+	pageviews.LoadBotSignatures(resources)
+	pageviews.LoadRateLimits()
+	pageviews.LoadTrustedProxies()
+
+	tracker.NewTracker(resources)
+
+	pageviews.StartIngestionQueue()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var backgroundTasks sync.WaitGroup
+	backgroundTasks.Add(2)
+	go func() {
+		defer backgroundTasks.Done()
+		runBackgroundTasks(ctx)
+	}()
+	go func() {
+		defer backgroundTasks.Done()
+		runRollupTasks(ctx)
+	}()
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -51,11 +81,42 @@ func main() {
 	}
 	port = ":" + port
 
+	server := &http.Server{Addr: port, Handler: newRouter()}
+	server.RegisterOnShutdown(pageviews.StopLiveVisitors)
+	serverErrors := make(chan error, 1)
+
 	slog.Info("starting server", "port", port)
-	err := http.ListenAndServe(port, newRouter())
-	if err != nil {
+	go func() {
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErrors:
 		panic(err)
+	case <-ctx.Done():
+	}
+
+	shutdown(server, &backgroundTasks)
+}
+
+// Runs on SIGTERM from the platform during deploys or Ctrl+C. In-flight requests get shutdownTimeout to finish,
+// then the queued pageviews are written and the background tasks stop before the database is closed
+func shutdown(server *http.Server, backgroundTasks *sync.WaitGroup) {
+	slog.Info("shutting down server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		slog.Error("error shutting down server", "error", err)
 	}
+
+	pageviews.StopIngestionQueue()
+	backgroundTasks.Wait()
+	sqlite.Close()
+
+	slog.Info("server stopped")
 }
 
 func newRouter() *http.ServeMux {
@@ -63,23 +124,40 @@ func newRouter() *http.ServeMux {
 
 	// public
 	mux.HandleFunc("GET /assets/", handleStaticAssets)
+	mux.HandleFunc("GET /script.js", tracker.HandleTrackerScript)
 	mux.HandleFunc("GET /collect", pageviews.HandleCollect)
+	mux.HandleFunc("POST /collect", pageviews.HandleCollect)
+	mux.HandleFunc("GET /collect/event", pageviews.HandleEventCollect)
+	mux.HandleFunc("POST /collect/event", pageviews.HandleEventCollect)
 	mux.HandleFunc("GET /login", login.HandleLoginPage)
 	mux.HandleFunc("POST /login", login.HandleLoginSubmit)
 
 	// private
 	addPrivateRoute(mux, "GET /", home.HandleHomePage)
+	addPrivateRoute(mux, "GET /live/{project_id}", live.HandleLivePage)
+	addPrivateRoute(mux, "GET /live/{project_id}/events", live.HandleLiveEvents)
 	addPrivateRoute(mux, "GET /settings", settings.HandleSettingsPage)
 	addPrivateRoute(mux, "GET /settings/server_url", settings.HandleServerURLPage)
 	addPrivateRoute(mux, "POST /settings/server_url", settings.HandleServerURLSubmit)
+	addPrivateRoute(mux, "GET /settings/rate_limits", settings.HandleRateLimitsPage)
+	addPrivateRoute(mux, "POST /settings/rate_limits", settings.HandleRateLimitsSubmit)
+	addPrivateRoute(mux, "GET /settings/trusted_proxies", settings.HandleTrustedProxiesPage)
+	addPrivateRoute(mux, "POST /settings/trusted_proxies", settings.HandleTrustedProxiesSubmit)
+	addPrivateRoute(mux, "GET /settings/retention", settings.HandleRetentionPage)
+	addPrivateRoute(mux, "POST /settings/retention", settings.HandleRetentionSubmit)
 	addPrivateRoute(mux, "GET /users/new", users.HandleNewUserPage)
 	addPrivateRoute(mux, "POST /users/new", users.HandleNewUserSubmit)
 	addPrivateRoute(mux, "GET /users/me/password", users.HandleChangePasswordPage)
 	addPrivateRoute(mux, "POST /users/me/password", users.HandleChangePasswordSubmit)
+	addPrivateRoute(mux, "GET /users/me/timezone", users.HandleTimezonePage)
+	addPrivateRoute(mux, "POST /users/me/timezone", users.HandleTimezoneSubmit)
 	addPrivateRoute(mux, "GET /projects/new", projects.HandleNewProjectPage)
 	addPrivateRoute(mux, "GET /projects/{project_id}", projects.HandleEditProjectPage)
 	addPrivateRoute(mux, "POST /projects/", projects.HandleProjectDetailSubmit)
 	addPrivateRoute(mux, "POST /projects/{project_id}", projects.HandleProjectDetailSubmit)
+	addPrivateRoute(mux, "GET /projects/{project_id}/goals/new", projects.HandleNewGoalPage)
+	addPrivateRoute(mux, "POST /projects/{project_id}/goals/new", projects.HandleNewGoalSubmit)
+	addPrivateRoute(mux, "POST /projects/{project_id}/goals/{goal_id}/delete", projects.HandleDeleteGoalSubmit)
 
 	return mux
 }
@@ -97,8 +175,41 @@ func addPrivateRoute(mux *http.ServeMux, pattern string, handlerFunc func(w http
 	mux.HandleFunc(pattern, auth.EnsureAuthenticated(handler))
 }
 
-func runBackgroundTasks() {
-	for range time.Tick(24 * time.Hour) {
+// Runs daily at midnight UTC so that visitor salts rotate along with the day boundary
+func runBackgroundTasks(ctx context.Context) {
+	pageviews.RotateSalts()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(getNextMidnightUTC())):
+		}
+
 		session.DeleteExpiredSessions()
+		pageviews.RotateSalts()
+		pageviews.PurgeExpiredData(ctx)
 	}
 }
+
+// Rolls up the hours completed since the last run, see pageviews.RollupPageViews
+func runRollupTasks(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	pageviews.RollupPageViews(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pageviews.RollupPageViews(ctx)
+		}
+	}
+}
+
+func getNextMidnightUTC() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
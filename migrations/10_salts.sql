@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS salts (
+	project_id TEXT NOT NULL,
+	day        TEXT NOT NULL,
+	salt       TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (project_id, day),
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE projects
+    ADD COLUMN should_respect_privacy_signals INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+ALTER TABLE projects
+    ADD COLUMN retention_months INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS pageview_daily_rollups (
+	project_id TEXT NOT NULL,
+	day        TEXT NOT NULL,
+	views      INTEGER NOT NULL,
+	visitors   INTEGER NOT NULL,
+
+	PRIMARY KEY (project_id, day),
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
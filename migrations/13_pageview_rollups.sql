@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS pageview_hourly_rollups (
+	project_id   TEXT NOT NULL,
+	hour         TEXT NOT NULL,
+	views        INTEGER NOT NULL,
+	visitors     INTEGER NOT NULL,
+	new_visitors INTEGER NOT NULL,
+
+	PRIMARY KEY (project_id, hour),
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pageview_hourly_path_rollups (
+	project_id   TEXT NOT NULL,
+	hour         TEXT NOT NULL,
+	path         TEXT NOT NULL,
+	title        TEXT NOT NULL,
+	views        INTEGER NOT NULL,
+	new_visitors INTEGER NOT NULL,
+
+	PRIMARY KEY (project_id, hour, path),
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pageview_hourly_referrer_rollups (
+	project_id TEXT NOT NULL,
+	hour       TEXT NOT NULL,
+	referrer   TEXT NOT NULL,
+	views      INTEGER NOT NULL,
+
+	PRIMARY KEY (project_id, hour, referrer),
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+
+-- Daily rollups of purged days become the first hour of their day
+INSERT INTO pageview_hourly_rollups (project_id, hour, views, visitors, new_visitors)
+	SELECT project_id, day || ' 00:00:00', views, visitors, visitors FROM pageview_daily_rollups;
+
+DROP TABLE pageview_daily_rollups;
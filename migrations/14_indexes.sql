@@ -0,0 +1,6 @@
+-- Every dashboard query filters on the project and a date range, as do the rollups and the retention purge
+CREATE INDEX IF NOT EXISTS pageviews_project_id_received_at
+    ON pageviews (project_id, received_at);
+
+CREATE INDEX IF NOT EXISTS events_project_id_received_at
+    ON events (project_id, received_at);
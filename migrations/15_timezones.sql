@@ -0,0 +1,5 @@
+ALTER TABLE projects
+    ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+
+ALTER TABLE users
+    ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
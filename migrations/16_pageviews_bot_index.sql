@@ -0,0 +1,5 @@
+-- Every pageview query also filters on is_bot, with it before received_at the bot count is read from the index alone
+DROP INDEX IF EXISTS pageviews_project_id_received_at;
+
+CREATE INDEX IF NOT EXISTS pageviews_project_id_is_bot_received_at
+    ON pageviews (project_id, is_bot, received_at);
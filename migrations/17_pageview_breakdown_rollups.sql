@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS pageview_hourly_breakdown_rollups (
+	project_id   TEXT NOT NULL,
+	hour         TEXT NOT NULL,
+	dimension    TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	views        INTEGER NOT NULL,
+	new_visitors INTEGER NOT NULL,
+
+	PRIMARY KEY (project_id, dimension, hour, name),
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
+
+-- Hours that are already rolled up are backfilled from the raw rows, the later ones are rolled up by the background task
+INSERT INTO pageview_hourly_breakdown_rollups (project_id, hour, dimension, name, views, new_visitors)
+	WITH hits AS (
+		SELECT
+			project_id,
+			received_at,
+			dimension,
+			name,
+			visitor_hash,
+			MIN(received_at) OVER (PARTITION BY project_id, DATE(received_at), dimension, name, visitor_hash) AS first_seen_at
+		FROM (
+			SELECT project_id, received_at, 'browser' AS dimension, COALESCE(browser, 'Unknown') AS name, visitor_hash FROM pageviews WHERE is_bot = 0
+			UNION ALL
+			SELECT project_id, received_at, 'os' AS dimension, COALESCE(os, 'Unknown') AS name, visitor_hash FROM pageviews WHERE is_bot = 0
+			UNION ALL
+			SELECT project_id, received_at, 'device_type' AS dimension, COALESCE(device_type, 'Unknown') AS name, visitor_hash FROM pageviews WHERE is_bot = 0
+		)
+		WHERE
+			received_at < (SELECT value FROM config WHERE key = 'rolled_up_until')
+	)
+	SELECT
+		project_id,
+		STRFTIME('%Y-%m-%d %H:00:00', received_at) AS hour,
+		dimension,
+		name,
+		COUNT(*) AS views,
+		COUNT(DISTINCT CASE WHEN received_at = first_seen_at THEN visitor_hash END) AS new_visitors
+	FROM
+		hits
+	GROUP BY
+		project_id,
+		hour,
+		dimension,
+		name;
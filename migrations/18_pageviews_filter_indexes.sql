@@ -0,0 +1,6 @@
+-- Filtered dashboard queries read the raw pageviews, these let the path and source filters read only the matching rows of the time range
+CREATE INDEX IF NOT EXISTS pageviews_project_id_is_bot_path_received_at
+    ON pageviews (project_id, is_bot, path, received_at);
+
+CREATE INDEX IF NOT EXISTS pageviews_project_id_is_bot_referrer_received_at
+    ON pageviews (project_id, is_bot, referrer, received_at);
@@ -0,0 +1,8 @@
+ALTER TABLE pageviews
+    ADD COLUMN browser TEXT;
+
+ALTER TABLE pageviews
+    ADD COLUMN os TEXT;
+
+ALTER TABLE pageviews
+    ADD COLUMN device_type TEXT;
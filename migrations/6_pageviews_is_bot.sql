@@ -0,0 +1,6 @@
+ALTER TABLE pageviews
+    ADD COLUMN is_bot INTEGER DEFAULT 0;
+
+UPDATE pageviews
+    SET is_bot = 1
+    WHERE device_type = 'Bot';
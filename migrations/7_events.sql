@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS events (
+	event_id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	project_id   TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	properties   TEXT NOT NULL,
+	path         TEXT NOT NULL,
+	visitor_hash TEXT,
+	is_bot       INTEGER DEFAULT 0,
+	received_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
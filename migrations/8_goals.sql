@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS goals (
+	goal_id    INTEGER PRIMARY KEY AUTOINCREMENT,
+	project_id TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	goal_type  TEXT NOT NULL,
+	target     TEXT NOT NULL,
+  	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+	FOREIGN KEY (project_id)
+		REFERENCES projects (project_id)
+		ON UPDATE CASCADE
+		ON DELETE CASCADE
+);
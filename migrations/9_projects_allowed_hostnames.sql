@@ -0,0 +1,5 @@
+ALTER TABLE projects
+    ADD COLUMN allowed_hostnames TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE projects
+    ADD COLUMN should_verify_origin INTEGER NOT NULL DEFAULT 0;